@@ -1,31 +1,77 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"syscall"
+	"time"
 
 	"todoapp/files"
 	"todoapp/handlers"
 	"todoapp/logging"
 	"todoapp/middleware"
+	"todoapp/reminder"
 	"todoapp/task"
 	"todoapp/webserver"
 )
 
 func main() {
-	requestChanSize := flag.Int("requestChanSize", 10, "Size of the request channel")
+	requestChanSize := flag.Int("requestChanSize", 10, "Size of the request channel of every shard")
+	numShards := flag.Int("shards", runtime.GOMAXPROCS(0), "Number of actor shards serving task requests")
+	submitTimeout := flag.Duration("submitTimeout", task.DefaultSubmitTimeout, "How long a request waits for queue space and for its response")
 	port := flag.String("port", "8081", "Port to run the backend server on")
+	snapshotInterval := flag.Duration("snapshotInterval", 5*time.Minute, "Interval between periodic snapshots, 0 disables them")
+	snapshotKeep := flag.Int("snapshotKeep", 3, "Number of previous snapshots to keep for recovery")
+	legacyRoutes := flag.Bool("legacyRoutes", false, "Also serve the legacy /create, /get, /update and /delete/{id} routes")
+	reminderInterval := flag.Duration("reminderInterval", time.Minute, "Interval between checks for due date reminders, 0 disables them")
+	reminderLead := flag.Duration("reminderLead", time.Hour, "How long before a task is due its reminder is sent")
+	reminderLeads := flag.String("reminderLeads", "", "Lead times of single users, e.g. 1=30m,2=2h")
+	reminderWebhook := flag.String("reminderWebhook", "", "URL reminders are posted to as JSON")
+	reminderSMTP := flag.String("reminderSMTP", "", "Address of the SMTP server reminders are mailed through, e.g. localhost:1025")
+	reminderFrom := flag.String("reminderFrom", "todo@localhost", "Sender address of reminder mails")
+	reminderTo := flag.String("reminderTo", "user%d@localhost", "Recipient address of reminder mails, %d is replaced by the user ID")
+	blockStart := flag.Bool("blockStart", false, "Also refuse to start tasks that are blocked by open tasks")
+	trashRetentionDays := flag.Int("trashRetentionDays", 0, "Days deleted tasks are kept before snapshots purge them, 0 keeps them forever")
+	attachmentQuotaMB := flag.Int64("attachmentQuotaMB", 100, "Megabytes of attachments every user may store, 0 removes the limit")
+	workflows := flag.String("workflows", "", "JSON file defining the status workflows of users, empty keeps the built-in statuses")
+	adminToken := flag.String("adminToken", os.Getenv("TODOAPP_ADMIN_TOKEN"), "Bearer token required by the /admin routes, empty disables them; defaults to $TODOAPP_ADMIN_TOKEN")
+	migrateDryRun := flag.Bool("migrateDryRun", false, "Report what migrating the data file would change and exit")
 	flag.Parse()
 
 	filename := filepath.Join("..", "files", "server_"+*port+".json")
+	journalFilename := filepath.Join("..", "files", "server_"+*port+".journal")
+	reminderFilename := filepath.Join("..", "files", "server_"+*port+".reminders.json")
+	historyFilename := filepath.Join("..", "files", "server_"+*port+".history.jsonl")
+	blobDirname := filepath.Join("..", "files", "server_"+*port+".blobs")
 
 	logging.InitLogging(*port)
 
+	if *migrateDryRun {
+		report, err := files.DryRunMigration(filename)
+		if err != nil {
+			log.Printf("Failed to dry-run migration: %v", err)
+			return
+		}
+		for _, line := range report {
+			fmt.Println(line)
+		}
+		return
+	}
+
+	if *workflows != "" {
+		if err := loadWorkflows(*workflows); err != nil {
+			log.Printf("Failed to load workflows: %v", err)
+			return
+		}
+	}
+
 	var tasks map[int][]task.Task
 	var maxTaskIDs map[int]int
 	err := files.LoadData(filename, &tasks, &maxTaskIDs)
@@ -34,49 +80,104 @@ func main() {
 		return
 	}
 
-	task.SetTasks(tasks, maxTaskIDs)
-	task.InitChannel(*requestChanSize)
+	replayed, err := files.ReplayJournal(journalFilename, &tasks, &maxTaskIDs)
+	if err != nil {
+		log.Printf("Failed to replay journal: %v", err)
+		return
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %d journal entries", replayed)
+	}
+
+	journal, err := files.OpenJournal(journalFilename)
+	if err != nil {
+		log.Printf("Failed to open journal: %v", err)
+		return
+	}
+	defer journal.Close()
+
+	history, err := files.OpenHistoryLog(historyFilename)
+	if err != nil {
+		log.Printf("Failed to open task history: %v", err)
+		return
+	}
+	defer history.Close()
+	task.SetHistoryStore(history)
+
+	blobs, err := files.OpenBlobDir(blobDirname)
+	if err != nil {
+		log.Printf("Failed to open attachment blobs: %v", err)
+		return
+	}
+	task.SetBlobStore(blobs)
+	task.SetAttachmentQuota(*attachmentQuotaMB << 20)
+
+	store := files.NewJournaledStore(task.NewMemoryStore(tasks, maxTaskIDs), journal)
+	snapshotter := &files.Snapshotter{
+		Store:    store,
+		Filename: filename,
+		Keep:     *snapshotKeep,
+	}
+
+	// Fold the replayed entries into the snapshot, so new entries are never appended after a torn one
+	if err := snapshotter.Snapshot(); err != nil {
+		log.Printf("Failed to save recovered tasks: %v", err)
+		return
+	}
+
+	task.SetStore(store)
+	task.SetSubmitTimeout(*submitTimeout)
+	task.SetBlockStart(*blockStart)
+	task.InitShards(*numShards, *requestChanSize)
+
+	// Purging goes through the actor loops, so it is only enabled once they run
+	snapshotter.Retention = time.Duration(*trashRetentionDays) * 24 * time.Hour
+	snapshotter.Purge = func(cutoff time.Time) (int, error) {
+		return task.PurgeExpired(context.Background(), cutoff)
+	}
 
 	defer func() {
-		tasks, maxTaskIDs = task.GetManagerTasks()
-		if err := files.SaveData(filename, tasks, maxTaskIDs); err != nil {
+		if err := snapshotter.Snapshot(); err != nil {
 			log.Printf("Failed to save tasks to file: %v", err)
 		} else {
 			log.Println("Tasks saved successfully")
 		}
 	}()
 
+	stopBackground := make(chan struct{})
+	defer close(stopBackground)
+	if *snapshotInterval > 0 {
+		go snapshotter.Run(*snapshotInterval, stopBackground)
+	}
+
+	if *reminderInterval > 0 {
+		scheduler, err := newReminderScheduler(*reminderLead, *reminderLeads, *reminderWebhook, *reminderSMTP, *reminderFrom, *reminderTo, reminderFilename)
+		if err != nil {
+			log.Printf("Failed to start reminders: %v", err)
+			return
+		}
+		log.Printf("%d reminders scheduled", len(scheduler.Upcoming(time.Now())))
+		go scheduler.Run(*reminderInterval, stopBackground)
+	}
+
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/create", func(w http.ResponseWriter, r *http.Request) {
-		middleware.ChainMiddleware(
-			http.HandlerFunc(handlers.CreateHandler),
-			middleware.TraceIDMiddleware,
-			middleware.UserIDMiddleware,
-		).ServeHTTP(w, r)
-	})
-	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
-		middleware.ChainMiddleware(
-			http.HandlerFunc(handlers.GetHandler),
+	handlers.RegisterRoutes(mux, *legacyRoutes, func(handler http.Handler) http.Handler {
+		return middleware.ChainMiddleware(handler,
 			middleware.TraceIDMiddleware,
-			middleware.UserIDMiddleware,
-		).ServeHTTP(w, r)
+			middleware.UserIDMiddleware)
 	})
 
-	mux.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
-		middleware.ChainMiddleware(
-			http.HandlerFunc(handlers.UpdateHandler),
+	// Admin routes are only served with a token, since anyone reaching the port could call them
+	if *adminToken != "" {
+		mux.Handle("/admin/snapshot", middleware.ChainMiddleware(
+			handlers.SnapshotHandler(snapshotter.Snapshot),
+			middleware.AdminTokenMiddleware(*adminToken),
 			middleware.TraceIDMiddleware,
-			middleware.UserIDMiddleware,
-		).ServeHTTP(w, r)
-	})
-	mux.HandleFunc("/delete/", func(w http.ResponseWriter, r *http.Request) {
-		middleware.ChainMiddleware(
-			http.HandlerFunc(handlers.DeleteHandler),
-			middleware.TraceIDMiddleware,
-			middleware.UserIDMiddleware,
-		).ServeHTTP(w, r)
-	})
+		))
+	} else {
+		log.Println("No -adminToken given, /admin routes are disabled")
+	}
 
 	webserver.ServeStaticPage(mux)
 	webserver.ServeDynamicPage(mux)
@@ -103,3 +204,33 @@ func main() {
 	}
 	log.Println("Server gracefully stopped.")
 }
+
+// newReminderScheduler creates the reminder scheduler with a notifier for every configured channel
+func newReminderScheduler(lead time.Duration, leads, webhookURL, smtpAddr, from, to, stateFile string) (*reminder.Scheduler, error) {
+	userLeads, err := reminder.ParseLeads(leads)
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers := reminder.Notifiers{reminder.LogNotifier{}}
+	if webhookURL != "" {
+		notifiers = append(notifiers, &reminder.WebhookNotifier{URL: webhookURL, Client: &http.Client{Timeout: 10 * time.Second}})
+	}
+	if smtpAddr != "" {
+		notifiers = append(notifiers, &reminder.SMTPNotifier{Addr: smtpAddr, From: from, To: to})
+	}
+	return reminder.NewScheduler(notifiers, lead, userLeads, stateFile)
+}
+
+// loadWorkflows reads the workflow configuration in filename and makes it the one tasks use
+func loadWorkflows(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	config, err := task.ParseWorkflowConfig(data)
+	if err != nil {
+		return err
+	}
+	return task.SetWorkflowConfig(config)
+}
@@ -7,6 +7,7 @@ require (
 	todoapp/handlers v0.0.0
 	todoapp/logging v0.0.0
 	todoapp/middleware v0.0.0
+	todoapp/reminder v0.0.0
 	todoapp/task v0.0.0
 	todoapp/webserver v0.0.0
 )
@@ -24,3 +25,5 @@ replace todoapp/webserver => ../webserver
 replace todoapp/logging => ../logging
 
 replace todoapp/middleware => ../middleware
+
+replace todoapp/reminder => ../reminder
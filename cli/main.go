@@ -6,19 +6,22 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"todoapp/files"
 	"todoapp/task"
 )
 
-var (
-	stop    chan os.Signal
-	manager task.Manager
-)
+// cliUserID is the user every task created from the CLI belongs to
+const cliUserID = 0
+
+var stop chan os.Signal
 
 func main() {
 	opts := &slog.HandlerOptions{
@@ -28,17 +31,16 @@ func main() {
 	logger := slog.New(slogHandler)
 	slog.SetDefault(logger)
 
-	manager = task.Manager{
-		Tasks:      make(map[int][]task.Task),
-		MaxTaskIDs: make(map[int]int),
-	}
-
-	err := files.LoadData("todo.json", &manager.Tasks, &manager.MaxTaskIDs)
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	err := files.LoadData("todo.json", &tasks, &maxTaskIDs)
 	if err != nil {
 		slog.Error("Failed to load data", "error", err)
 		os.Exit(1)
 	}
 
+	task.SetTasks(tasks, maxTaskIDs)
+
 	stop = make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
@@ -51,7 +53,8 @@ func main() {
 }
 
 func saveTasks() {
-	if err := files.SaveData("todo.json", manager.Tasks, manager.MaxTaskIDs); err != nil {
+	tasks, maxTaskIDs := task.GetManagerTasks()
+	if err := files.SaveData("todo.json", tasks, maxTaskIDs); err != nil {
 		slog.Error("Failed to save tasks to file", "error", err)
 	} else {
 		slog.Info("Tasks saved successfully")
@@ -67,8 +70,18 @@ func runCLI() {
 		command := strings.TrimSpace(input)
 
 		switch {
-		case command == "get":
-			printTasks()
+		case command == "get" || strings.HasPrefix(command, "get "):
+			printTasks(command)
+		case command == "tree":
+			printTaskTree()
+		case command == "next":
+			printNextTasks()
+		case command == "trash":
+			printTrash()
+		case strings.HasPrefix(command, "restore "):
+			handleRestore(command)
+		case strings.HasPrefix(command, "purge "):
+			handlePurge(command)
 		case strings.HasPrefix(command, "create"):
 			handleCreate(command)
 		case command == "exit":
@@ -78,8 +91,15 @@ func runCLI() {
 		case command == "help":
 			fmt.Println("Available commands:")
 			fmt.Println("  get                                   - Retrieve and display all tasks")
-			fmt.Println("  create -title <title> -desc <description> -status <status> - Create a new task with the given details.")
-			fmt.Println("      Example: create -title \"Golang\" -desc \"Task1\" -status \"NotStarted\"")
+			fmt.Println("  get -status <status> -priority <priority> -title <text> -tags_all <tags> -tags_any <tags> -due <overdue|today|week> -sort <field> -order <asc|desc> -limit <n> - Retrieve matching tasks.")
+			fmt.Println("      Example: get -status \"NotStarted,Started\" -sort created_at -order desc")
+			fmt.Println("  tree                                  - Display tasks with their subtasks indented")
+			fmt.Println("  next                                  - Display the open tasks nothing blocks, most pressing first")
+			fmt.Println("  trash                                 - Display the deleted tasks, most recently deleted first")
+			fmt.Println("  restore <id>                          - Take a deleted task out of the trash")
+			fmt.Println("  purge <id>                            - Permanently remove a deleted task")
+			fmt.Println("  create -title <title> -desc <description> -status <status> [-priority <priority>] [-tags <tag,tag>] [-parent <id>] [-blocked_by <id,id>] [-due <YYYY-MM-DD>] [-recurrence <rule>] - Create a new task with the given details.")
+			fmt.Println("      Example: create -title \"Golang\" -desc \"Task1\" -status \"NotStarted\" -priority High -tags backend,go -due 2030-01-31")
 			fmt.Println("  exit                                  - Exit the CLI")
 			fmt.Println("  help                                  - Show this help message")
 		default:
@@ -88,8 +108,31 @@ func runCLI() {
 	}
 }
 
-func printTasks() {
-	tasks := task.GetTasks()
+func printTasks(command string) {
+	getCmd := flag.NewFlagSet("get", flag.ContinueOnError)
+	query := url.Values{}
+	for _, name := range []string{"status", "priority", "title", "sort", "order", "limit", "created_after", "created_before", "due", "due_after", "due_before", "tags_all", "tags_any"} {
+		getCmd.Func(name, "filter or order the tasks by "+name, func(value string) error {
+			query.Set(name, value)
+			return nil
+		})
+	}
+	if err := getCmd.Parse(strings.Fields(command)[1:]); err != nil {
+		fmt.Println("Failed to parse arguments:", err)
+		return
+	}
+
+	listOptions, err := task.ParseListOptions(query)
+	if err != nil {
+		fmt.Println("Invalid filter:", err)
+		return
+	}
+
+	tasks, _, err := task.ListTasks(cliUserID, listOptions)
+	if err != nil {
+		fmt.Println("Failed to get tasks:", err)
+		return
+	}
 	if len(tasks) == 0 {
 		fmt.Println("No tasks found.")
 		return
@@ -101,6 +144,114 @@ func printTasks() {
 		return
 	}
 	fmt.Println(string(tasksJSON))
+
+	now := time.Now()
+	overdue := 0
+	for _, t := range tasks {
+		if t.IsOverdue(now) {
+			overdue++
+		}
+	}
+	if overdue > 0 {
+		fmt.Printf("%d task(s) overdue.\n", overdue)
+	}
+}
+
+func printTaskTree() {
+	tree, err := task.GetTaskTree(cliUserID, task.ListOptions{})
+	if err != nil {
+		fmt.Println("Failed to get tasks:", err)
+		return
+	}
+	if len(tree) == 0 {
+		fmt.Println("No tasks found.")
+		return
+	}
+	printTreeNodes(tree, 0)
+}
+
+func printNextTasks() {
+	tasks, err := task.GetNextTasks(cliUserID)
+	if err != nil {
+		fmt.Println("Failed to get tasks:", err)
+		return
+	}
+	if len(tasks) == 0 {
+		fmt.Println("Nothing to work on.")
+		return
+	}
+	for _, t := range tasks {
+		fmt.Printf("[%d] %s (%s, %s)\n", t.ID, t.Title, t.StatusString, t.PriorityString)
+	}
+}
+
+func printTrash() {
+	tasks, err := task.GetDeletedTasks(cliUserID)
+	if err != nil {
+		fmt.Println("Failed to get deleted tasks:", err)
+		return
+	}
+	if len(tasks) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+	for _, t := range tasks {
+		line := fmt.Sprintf("[%d] %s", t.ID, t.Title)
+		if t.DeletedAt != nil {
+			line += " (deleted " + t.DeletedAt.Format("2006-01-02 15:04") + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// trashTaskID parses the task ID argument of the restore and purge commands
+func trashTaskID(command string) (int, bool) {
+	args := strings.Fields(command)
+	if len(args) != 2 {
+		fmt.Printf("Usage: %s <id>\n", args[0])
+		return 0, false
+	}
+	taskID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Println("Invalid task ID:", args[1])
+		return 0, false
+	}
+	return taskID, true
+}
+
+func handleRestore(command string) {
+	taskID, ok := trashTaskID(command)
+	if !ok {
+		return
+	}
+	if _, err := task.RestoreTask(cliUserID, taskID); err != nil {
+		fmt.Println("Failed to restore task:", err)
+		return
+	}
+	fmt.Println("Task restored successfully.")
+}
+
+func handlePurge(command string) {
+	taskID, ok := trashTaskID(command)
+	if !ok {
+		return
+	}
+	if err := task.PurgeTask(cliUserID, taskID); err != nil {
+		fmt.Println("Failed to purge task:", err)
+		return
+	}
+	fmt.Println("Task purged successfully.")
+}
+
+func printTreeNodes(nodes []task.TreeNode, depth int) {
+	for _, node := range nodes {
+		line := fmt.Sprintf("%s[%d] %s (%s)", strings.Repeat("  ", depth), node.ID, node.Title, node.StatusString)
+		if node.Progress != nil {
+			line += fmt.Sprintf(" %d/%d subtasks done", node.Progress.Completed, node.Progress.Total)
+		}
+		fmt.Println(line)
+		printTreeNodes(node.Children, depth+1)
+	}
 }
 
 func handleCreate(command string) {
@@ -108,10 +259,16 @@ func handleCreate(command string) {
 	title := createCmd.String("title", "", "Title of the task")
 	description := createCmd.String("description", "", "Description of the task")
 	status := createCmd.String("status", "", "Status of the task (NotStarted, Started, Completed)")
+	priority := createCmd.String("priority", "", "Priority of the task (Low, Medium, High, Urgent or P3 to P0), Medium if empty")
+	tags := createCmd.String("tags", "", "Comma-separated tags of the task")
+	parent := createCmd.Int("parent", 0, "ID of the task this is a subtask of")
+	blockedBy := createCmd.String("blocked_by", "", "Comma-separated IDs of the tasks that must be completed first")
+	due := createCmd.String("due", "", "Due date of the task (YYYY-MM-DD or RFC 3339)")
+	recurrence := createCmd.String("recurrence", "", "Recurrence rule of the task, e.g. FREQ=WEEKLY;BYDAY=MO,TH; needs -due")
 
 	args := strings.Fields(command)
 	if len(args) < 2 {
-		fmt.Println("Usage: create -title <title> -description <description> -status <status>")
+		fmt.Println("Usage: create -title <title> -description <description> -status <status> [-priority <priority>] [-tags <tags>] [-parent <id>] [-blocked_by <ids>] [-due <date>] [-recurrence <rule>]")
 		return
 	}
 	err := createCmd.Parse(args[1:])
@@ -121,11 +278,35 @@ func handleCreate(command string) {
 	}
 
 	newTask := task.Task{
-		Title:        *title,
-		Description:  *description,
-		StatusString: *status,
+		Title:          *title,
+		Description:    *description,
+		StatusString:   *status,
+		PriorityString: *priority,
+		ParentID:       *parent,
+		Recurrence:     *recurrence,
+	}
+	if *tags != "" {
+		newTask.Tags = strings.Split(*tags, ",")
+	}
+	if *blockedBy != "" {
+		for _, id := range strings.Split(*blockedBy, ",") {
+			blocker, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				fmt.Println("Invalid task ID in -blocked_by:", id)
+				return
+			}
+			newTask.BlockedBy = append(newTask.BlockedBy, blocker)
+		}
+	}
+	if *due != "" {
+		dueDate, err := task.ParseTime(*due)
+		if err != nil {
+			fmt.Println("Invalid due date:", err)
+			return
+		}
+		newTask.DueDate = &dueDate
 	}
-	err = task.CreateTask(newTask)
+	_, err = task.CreateTask(cliUserID, newTask)
 	if err != nil {
 		fmt.Println("Failed to create task:", err)
 		return
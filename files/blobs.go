@@ -0,0 +1,122 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"todoapp/task"
+)
+
+// BlobDir is a task.BlobStore that keeps every blob as a file named after its SHA-256 digest
+// Blobs are stored under <dir>/<userID>/<first two digits>/<digest>.
+type BlobDir struct {
+	dir string
+}
+
+// OpenBlobDir opens the blob directory dir, creating it if needed
+func OpenBlobDir(dir string) (*BlobDir, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &BlobDir{dir: dir}, nil
+}
+
+// path returns the file of the blob with digest, rejecting anything that is not a hex SHA-256 digest
+func (b *BlobDir) path(userID int, digest string) (string, error) {
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid blob digest %q", digest)
+	}
+	return filepath.Join(b.dir, strconv.Itoa(userID), digest[:2], digest), nil
+}
+
+// Put writes the content read from r to a temporary file that is synced and renamed to its digest
+// Content that is already stored is kept as it is.
+func (b *BlobDir) Put(userID int, r io.Reader) (string, int64, error) {
+	userDir := filepath.Join(b.dir, strconv.Itoa(userID))
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		return "", 0, err
+	}
+	file, err := os.CreateTemp(userDir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpName := file.Name()
+	defer os.Remove(tmpName)
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		file.Close()
+		return "", 0, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		return "", 0, err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	path, _ := b.path(userID, digest)
+	if _, err := os.Stat(path); err == nil {
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return "", 0, err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// Open opens the file of the blob with digest
+func (b *BlobDir) Open(userID int, digest string) (io.ReadCloser, error) {
+	path, err := b.path(userID, digest)
+	if err != nil {
+		return nil, task.ErrBlobNotFound
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, task.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// Has reports whether the file of the blob with digest exists
+func (b *BlobDir) Has(userID int, digest string) (bool, error) {
+	path, err := b.path(userID, digest)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the file of the blob with digest
+func (b *BlobDir) Delete(userID int, digest string) error {
+	path, err := b.path(userID, digest)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
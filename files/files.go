@@ -2,19 +2,26 @@ package files
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"todoapp/task"
 )
 
 type dataFormat struct {
+	Version    int                 `json:"version"`
 	Tasks      map[int][]task.Task `json:"tasks"`
 	MaxTaskIDs map[int]int         `json:"maxTaskIDs"`
 }
 
 // LoadData initializes the list of tasks and maxTaskID from a JSON file
+// Files written by an older version are migrated to the current format.
 func LoadData(filePath string, tasks *map[int][]task.Task, maxTaskIDs *map[int]int) error {
-	file, err := os.Open(filePath)
+	data, err := readData(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			*tasks = make(map[int][]task.Task)
@@ -25,43 +32,161 @@ func LoadData(filePath string, tasks *map[int][]task.Task, maxTaskIDs *map[int]i
 		return err
 	}
 
+	fromVersion := data.Version
+	report, err := migrate(&data)
+	if err != nil {
+		return err
+	}
+	if fromVersion != data.Version {
+		slog.Info("Migrated data file", "file", filePath, "from", fromVersion, "to", data.Version, "changes", len(report))
+	}
+
+	*tasks = data.Tasks
+	*maxTaskIDs = data.MaxTaskIDs
+	return nil
+}
+
+// DryRunMigration reports what LoadData would change when migrating the file at filePath
+// The file is left untouched.
+func DryRunMigration(filePath string) ([]string, error) {
+	data, err := readData(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if data.Version == currentVersion {
+		return []string{fmt.Sprintf("already at version %d, nothing to migrate", currentVersion)}, nil
+	}
+	return migrate(&data)
+}
+
+func readData(filePath string) (dataFormat, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return dataFormat{}, err
+	}
+
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
 	data := dataFormat{}
 
 	if err := decoder.Decode(&data); err != nil {
-		return err
+		return dataFormat{}, err
 	}
-
-	*tasks = data.Tasks
-	*maxTaskIDs = data.MaxTaskIDs
-	return nil
+	return data, nil
 }
 
 // SaveData saves the tasks to a JSON file
+// The data is written to a temporary file that is synced and renamed over filename,
+// so a crash in the middle of a save never leaves a partially written file behind.
 func SaveData(filename string, tasks map[int][]task.Task, maxTaskIDs map[int]int) error {
-	file, err := os.Create(filename)
+	return saveData(filename, 0, tasks, maxTaskIDs)
+}
+
+// SaveSnapshot saves the tasks like SaveData and keeps the previous keep versions
+// of filename as filename.1 (most recent) to filename.<keep>
+func SaveSnapshot(filename string, keep int, tasks map[int][]task.Task, maxTaskIDs map[int]int) error {
+	return saveData(filename, keep, tasks, maxTaskIDs)
+}
+
+func saveData(filename string, keep int, tasks map[int][]task.Task, maxTaskIDs map[int]int) error {
+	dir := filepath.Dir(filename)
+	file, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-
-		}
-	}(file)
+	tmpName := file.Name()
+	defer os.Remove(tmpName)
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
 	data := dataFormat{
+		Version:    currentVersion,
 		Tasks:      tasks,
 		MaxTaskIDs: maxTaskIDs,
 	}
 
 	if err := encoder.Encode(&data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
 		return err
 	}
 
+	if keep > 0 {
+		if err := rotateSnapshots(filename, keep); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateSnapshots shifts filename.1 .. filename.<keep-1> up by one and copies filename to filename.1
+// filename itself stays in place, so there is always a complete snapshot to load
+func rotateSnapshots(filename string, keep int) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := keep - 1; i >= 1; i-- {
+		from := filename + "." + strconv.Itoa(i)
+		to := filename + "." + strconv.Itoa(i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	previous := filename + ".1"
+	if err := os.Remove(previous); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(filename, previous); err == nil {
+		return nil
+	}
+	return copyFile(filename, previous)
+}
+
+func copyFile(from string, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
 	return nil
 }
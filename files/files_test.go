@@ -0,0 +1,441 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"todoapp/task"
+)
+
+// benchmarkJournaledCreate creates tasks for a different user on every parallel goroutine through
+// a JournaledStore, whose single journal syncs every change whichever shard makes it
+func benchmarkJournaledCreate(b *testing.B, numShards int) {
+	journal, err := OpenJournal(filepath.Join(b.TempDir(), "bench.journal"))
+	if err != nil {
+		b.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer journal.Close()
+	task.SetStore(NewJournaledStore(task.NewMemoryStore(nil, nil), journal))
+	defer task.SetTasks(nil, nil)
+	task.InitShards(numShards, 1000)
+
+	var nextUserID atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		userID := int(nextUserID.Add(1))
+		for pb.Next() {
+			response := make(chan task.Response)
+			task.Send(task.Request{
+				UserID:   userID,
+				Action:   task.CreateRequest,
+				Task:     task.Task{Title: "Benchmark Task", StatusString: "NotStarted"},
+				Response: response,
+			})
+			<-response
+		}
+	})
+}
+
+func BenchmarkJournaledCreateSingleShard(b *testing.B) {
+	benchmarkJournaledCreate(b, 1)
+}
+
+func BenchmarkJournaledCreateSharded(b *testing.B) {
+	benchmarkJournaledCreate(b, runtime.GOMAXPROCS(0))
+}
+
+func TestJournaledStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "server.journal")
+
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+
+	store := NewJournaledStore(task.NewMemoryStore(nil, nil), journal)
+	first, _ := store.Create(1, task.Task{Title: "Task 1"})
+	second, _ := store.Create(1, task.Task{Title: "Task 2"})
+	first.Title = "Updated Task 1"
+	if err := store.Update(1, first); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := store.Delete(1, second.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Update(1, task.Task{ID: 999, Title: "Missing"}); err != task.ErrTaskNotFound {
+		t.Fatalf("Expected ErrTaskNotFound, got %v", err)
+	}
+	journal.Close()
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	replayed, err := ReplayJournal(journalPath, &tasks, &maxTaskIDs)
+	if err != nil {
+		t.Fatalf("ReplayJournal failed: %v", err)
+	}
+	if replayed != 5 {
+		t.Errorf("Expected 5 replayed entries, got %d", replayed)
+	}
+	if len(tasks[1]) != 1 || tasks[1][0].Title != "Updated Task 1" {
+		t.Errorf("Unexpected tasks after replay: %+v", tasks[1])
+	}
+	if maxTaskIDs[1] != 2 {
+		t.Errorf("Expected max task ID 2, got %d", maxTaskIDs[1])
+	}
+
+	// Replaying on top of a snapshot that already holds the entries changes nothing
+	if _, err := ReplayJournal(journalPath, &tasks, &maxTaskIDs); err != nil {
+		t.Fatalf("second ReplayJournal failed: %v", err)
+	}
+	if len(tasks[1]) != 1 || tasks[1][0].Title != "Updated Task 1" {
+		t.Errorf("Replay is not idempotent: %+v", tasks[1])
+	}
+}
+
+func TestReplayJournalTornEntry(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "server.journal")
+
+	torn := `{"op":"create","user_id":1,"task":{"id":1,"title":"Task 1"}}` + "\n" + `{"op":"update","user_id":1,"ta`
+	if err := os.WriteFile(journalPath, []byte(torn), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	replayed, err := ReplayJournal(journalPath, &tasks, &maxTaskIDs)
+	if err != nil {
+		t.Fatalf("Expected torn last entry to be ignored, got %v", err)
+	}
+	if replayed != 1 || len(tasks[1]) != 1 {
+		t.Errorf("Expected 1 replayed task, got %d entries and %+v", replayed, tasks[1])
+	}
+
+	corrupt := `{"op":"create","user_id":1,"ta` + "\n" + `{"op":"create","user_id":1,"task":{"id":1,"title":"Task 1"}}` + "\n"
+	if err := os.WriteFile(journalPath, []byte(corrupt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReplayJournal(journalPath, &tasks, &maxTaskIDs); err == nil {
+		t.Errorf("Expected an error for a corrupt entry in the middle of the journal")
+	}
+}
+
+func TestJournaledStoreCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "server.journal")
+	snapshotPath := filepath.Join(dir, "server.json")
+
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	store := NewJournaledStore(task.NewMemoryStore(nil, nil), journal)
+	store.Create(1, task.Task{Title: "Task 1"})
+
+	err = store.Checkpoint(func(tasks map[int][]task.Task, maxTaskIDs map[int]int) error {
+		return SaveData(snapshotPath, tasks, maxTaskIDs)
+	})
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+
+	info, err := os.Stat(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected journal to be truncated, got %d bytes", info.Size())
+	}
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	if err := LoadData(snapshotPath, &tasks, &maxTaskIDs); err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if len(tasks[1]) != 1 || maxTaskIDs[1] != 1 {
+		t.Errorf("Unexpected snapshot: %+v %+v", tasks, maxTaskIDs)
+	}
+}
+
+func TestSnapshotPurgesExpiredTasks(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(filepath.Join(dir, "server.journal"))
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	monthAgo := time.Now().AddDate(0, -1, 0)
+	yesterday := time.Now().AddDate(0, 0, -1)
+	store := NewJournaledStore(task.NewMemoryStore(map[int][]task.Task{
+		1: {
+			{ID: 1, Title: "Expired", Deleted: true, DeletedAt: &monthAgo},
+			{ID: 2, Title: "Recently deleted", Deleted: true, DeletedAt: &yesterday},
+			{ID: 3, Title: "Open", BlockedBy: []int{1}},
+		},
+	}, map[int]int{1: 3}), journal)
+	task.SetStore(store)
+	defer task.SetTasks(nil, nil)
+	task.InitChannel(10)
+
+	snapshotter := &Snapshotter{
+		Store:     store,
+		Filename:  filepath.Join(dir, "server.json"),
+		Retention: 7 * 24 * time.Hour,
+		Purge: func(cutoff time.Time) (int, error) {
+			return task.PurgeExpired(context.Background(), cutoff)
+		},
+	}
+	if err := snapshotter.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	if err := LoadData(snapshotter.Filename, &tasks, &maxTaskIDs); err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if len(tasks[1]) != 2 || tasks[1][0].ID != 2 || len(tasks[1][1].BlockedBy) != 0 {
+		t.Errorf("Expected only the expired task and references to it to be purged, got %+v", tasks[1])
+	}
+	if maxTaskIDs[1] != 3 {
+		t.Errorf("Expected purging to keep the max task ID, got %d", maxTaskIDs[1])
+	}
+}
+
+func TestHistoryLogReopen(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "server.history.jsonl")
+
+	history, err := OpenHistoryLog(historyPath)
+	if err != nil {
+		t.Fatalf("OpenHistoryLog failed: %v", err)
+	}
+	err = history.Append(
+		task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeCreated, Revision: 1},
+		task.HistoryEntry{TaskID: 2, UserID: 1, Change: task.ChangeCreated, Revision: 1},
+	)
+	if err == nil {
+		err = history.Append(task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeUpdated, Revision: 2})
+	}
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	history.Close()
+
+	// A torn last line is cut off on reopening
+	file, _ := os.OpenFile(historyPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"task_id": 1, "user_id`)
+	file.Close()
+
+	history, err = OpenHistoryLog(historyPath)
+	if err != nil {
+		t.Fatalf("OpenHistoryLog failed: %v", err)
+	}
+	if err := history.Append(task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeDeleted, Revision: 3}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	history.Close()
+
+	history, err = OpenHistoryLog(historyPath)
+	if err != nil {
+		t.Fatalf("OpenHistoryLog after appending to a torn log failed: %v", err)
+	}
+	defer history.Close()
+	entries, _ := history.List(1, 1)
+	if len(entries) != 3 || entries[0].Change != task.ChangeCreated || entries[1].Revision != 2 || entries[2].Change != task.ChangeDeleted {
+		t.Errorf("Unexpected entries after reopening: %+v", entries)
+	}
+	if entries, _ := history.List(2, 1); len(entries) != 0 {
+		t.Errorf("Expected no entries of another user, got %+v", entries)
+	}
+	if entries, _ := history.ListUserSince(1, time.Time{}); len(entries) != 4 {
+		t.Errorf("Expected the entries of both tasks of the user, got %+v", entries)
+	}
+}
+
+// shortWriteFile writes half of every write to the history file and then fails
+type shortWriteFile struct {
+	historyFile
+}
+
+func (f shortWriteFile) Write(p []byte) (int, error) {
+	n, _ := f.historyFile.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestHistoryLogCutsOffFailedAppend(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "server.history.jsonl")
+
+	history, err := OpenHistoryLog(historyPath)
+	if err != nil {
+		t.Fatalf("OpenHistoryLog failed: %v", err)
+	}
+	if err := history.Append(task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeCreated, Revision: 1}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	file := history.file
+	history.file = shortWriteFile{file}
+	if err := history.Append(task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeUpdated, Revision: 2}); err == nil {
+		t.Fatal("Expected the short write to fail")
+	}
+	history.file = file
+	if err := history.Append(task.HistoryEntry{TaskID: 1, UserID: 1, Change: task.ChangeDeleted, Revision: 3}); err != nil {
+		t.Fatalf("Append after a failed write failed: %v", err)
+	}
+	history.Close()
+
+	// The failed entry left nothing behind, so the log opens with the two entries that were written
+	history, err = OpenHistoryLog(historyPath)
+	if err != nil {
+		t.Fatalf("OpenHistoryLog after a failed write failed: %v", err)
+	}
+	defer history.Close()
+	entries, _ := history.List(1, 1)
+	if len(entries) != 2 || entries[0].Revision != 1 || entries[1].Revision != 3 {
+		t.Errorf("Unexpected entries after a failed write: %+v", entries)
+	}
+}
+
+func TestSaveSnapshotKeepsPrevious(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "server.json")
+
+	for i := 1; i <= 4; i++ {
+		tasks := map[int][]task.Task{1: {{ID: i, Title: "Task"}}}
+		if err := SaveSnapshot(snapshotPath, 2, tasks, map[int]int{1: i}); err != nil {
+			t.Fatalf("SaveSnapshot %d failed: %v", i, err)
+		}
+	}
+
+	for suffix, expectedMaxID := range map[string]int{"": 4, ".1": 3, ".2": 2} {
+		var tasks map[int][]task.Task
+		var maxTaskIDs map[int]int
+		if err := LoadData(snapshotPath+suffix, &tasks, &maxTaskIDs); err != nil {
+			t.Fatalf("LoadData(%q) failed: %v", suffix, err)
+		}
+		if maxTaskIDs[1] != expectedMaxID {
+			t.Errorf("Expected snapshot %q to have max task ID %d, got %d", suffix, expectedMaxID, maxTaskIDs[1])
+		}
+	}
+
+	if _, err := os.Stat(snapshotPath + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 previous snapshots to be kept")
+	}
+
+	leftovers, _ := filepath.Glob(snapshotPath + ".tmp-*")
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files, got %v", leftovers)
+	}
+}
+
+func TestLoadDataMigratesVersion0(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "server.json")
+	legacy := `{
+  "tasks": {
+    "1": [
+      {"id": 1, "title": "Task 1", "status_id": 1, "status": "Not Started"},
+      {"id": 3, "title": "Task 3", "status": "Completed"}
+    ]
+  },
+  "maxTaskIDs": {"1": 2}
+}`
+	if err := os.WriteFile(snapshotPath, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DryRunMigration(snapshotPath)
+	if err != nil {
+		t.Fatalf("DryRunMigration failed: %v", err)
+	}
+	if len(report) != 7 {
+		t.Errorf("Expected a header and 3 changes for version 1, and a header and 2 changes for version 2, got %q", report)
+	}
+	if content, _ := os.ReadFile(snapshotPath); string(content) != legacy {
+		t.Errorf("Expected dry run to leave the file untouched")
+	}
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	if err := LoadData(snapshotPath, &tasks, &maxTaskIDs); err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if tasks[1][0].StatusString != "NotStarted" {
+		t.Errorf("Expected status to be normalized, got %q", tasks[1][0].StatusString)
+	}
+	if tasks[1][1].StatusID != task.Completed {
+		t.Errorf("Expected status_id to be backfilled, got %d", tasks[1][1].StatusID)
+	}
+	if maxTaskIDs[1] != 3 {
+		t.Errorf("Expected max task ID to be backfilled to 3, got %d", maxTaskIDs[1])
+	}
+	if tasks[1][0].PriorityID != task.Medium || tasks[1][0].PriorityString != "Medium" {
+		t.Errorf("Expected priority to be backfilled to Medium, got %d %q", tasks[1][0].PriorityID, tasks[1][0].PriorityString)
+	}
+}
+
+func TestLoadDataRejectsNewerVersion(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "server.json")
+	if err := os.WriteFile(snapshotPath, []byte(`{"version": 999, "tasks": {}, "maxTaskIDs": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks map[int][]task.Task
+	var maxTaskIDs map[int]int
+	if err := LoadData(snapshotPath, &tasks, &maxTaskIDs); err == nil {
+		t.Errorf("Expected an error for a file newer than the supported version")
+	}
+}
+
+func TestBlobDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "server.blobs")
+	blobs, err := OpenBlobDir(dir)
+	if err != nil {
+		t.Fatalf("OpenBlobDir failed: %v", err)
+	}
+
+	digest, size, err := blobs.Put(1, strings.NewReader("log output"))
+	if err != nil || size != 10 || len(digest) != 64 {
+		t.Fatalf("Unexpected Put result %q %d: %v", digest, size, err)
+	}
+	if again, _, err := blobs.Put(1, strings.NewReader("log output")); err != nil || again != digest {
+		t.Errorf("Expected the same content to get the same digest, got %q: %v", again, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1", digest[:2], digest)); err != nil {
+		t.Errorf("Expected the blob to be stored under its digest: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "1", "upload-*")); len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files to be left behind, got %v", leftovers)
+	}
+
+	content, err := blobs.Open(1, digest)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if string(data) != "log output" {
+		t.Errorf("Expected the stored content, got %q", data)
+	}
+
+	// Blobs are kept per user
+	if ok, _ := blobs.Has(2, digest); ok {
+		t.Error("Expected the blob of user 1 to be missing for user 2")
+	}
+	if err := blobs.Delete(1, digest); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := blobs.Open(1, digest); !errors.Is(err, task.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound after deleting, got %v", err)
+	}
+	if _, err := blobs.Open(1, "../../server.json"); !errors.Is(err, task.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for a digest that is not one, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package files
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"todoapp/task"
+)
+
+// HistoryLog is a task.HistoryStore that appends every entry to a file as a line of JSON
+// Entries are never rewritten, so the file is an audit trail; they are also kept in memory for reading.
+type HistoryLog struct {
+	mu   sync.Mutex
+	file historyFile
+	// size is the length of the complete lines in the file, where the next entry starts
+	size int64
+	// torn is set while a failed write could not be cut off, so the next append cuts it off first
+	torn   bool
+	memory *task.MemoryHistory
+}
+
+// historyFile is the file a HistoryLog appends to
+type historyFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// OpenHistoryLog loads the entries of the history file at filePath and opens it for appending, creating it if needed
+// A torn last line, left by a crash in the middle of an append, is cut off so new entries start on a line of their own.
+func OpenHistoryLog(filePath string) (*HistoryLog, error) {
+	memory := task.NewMemoryHistory()
+	valid, err := loadHistory(filePath, memory)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &HistoryLog{file: file, size: valid, memory: memory}, nil
+}
+
+// loadHistory appends the entries of the history file at filePath to memory
+// It returns the length of the complete lines, which is where the next entry belongs.
+func loadHistory(filePath string, memory *task.MemoryHistory) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var valid int64
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				slog.Warn("Ignoring torn last history entry", "line", lineNumber)
+			}
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var entry task.HistoryEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, fmt.Errorf("history line %d: %w", lineNumber, err)
+		}
+		memory.Append(entry)
+		valid += int64(len(line))
+	}
+}
+
+// Append writes the entries to the file, syncs it and then makes them readable
+// A failed write is cut off again, so the next entry does not continue a torn line.
+func (h *HistoryLog) Append(entries ...task.HistoryEntry) error {
+	var lines []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.torn {
+		if err := h.file.Truncate(h.size); err != nil {
+			return fmt.Errorf("failed to cut off a torn history entry: %w", err)
+		}
+		h.torn = false
+	}
+	if err := h.write(lines); err != nil {
+		if truncateErr := h.file.Truncate(h.size); truncateErr != nil {
+			h.torn = true
+			return errors.Join(err, fmt.Errorf("failed to cut off the torn history entry: %w", truncateErr))
+		}
+		return err
+	}
+	h.size += int64(len(lines))
+	return h.memory.Append(entries...)
+}
+
+// write appends lines to the file and syncs it; the caller holds mu
+func (h *HistoryLog) write(lines []byte) error {
+	if _, err := h.file.Write(lines); err != nil {
+		return err
+	}
+	return h.file.Sync()
+}
+
+// List returns the entries of a task, oldest first
+func (h *HistoryLog) List(userID int, taskID int) ([]task.HistoryEntry, error) {
+	return h.memory.List(userID, taskID)
+}
+
+// ListUserSince returns the entries of every task of a user recorded at or after since, oldest first
+func (h *HistoryLog) ListUserSince(userID int, since time.Time) ([]task.HistoryEntry, error) {
+	return h.memory.ListUserSince(userID, since)
+}
+
+// Close closes the history file
+func (h *HistoryLog) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.file.Close()
+}
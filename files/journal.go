@@ -0,0 +1,247 @@
+package files
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"todoapp/task"
+)
+
+const (
+	journalCreate = "create"
+	journalUpdate = "update"
+	journalDelete = "delete"
+)
+
+// journalEntry is a single mutation recorded in the journal
+type journalEntry struct {
+	Op     string     `json:"op"`
+	UserID int        `json:"user_id"`
+	Task   *task.Task `json:"task,omitempty"`
+	TaskID int        `json:"task_id,omitempty"`
+}
+
+// Journal is an append-only log of task mutations
+// Every entry is synced to disk before the append returns
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenJournal opens the journal at filePath for appending, creating it if needed
+func OpenJournal(filePath string) (*Journal, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+func (j *Journal) append(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Truncate discards every entry of the journal
+// It is called once the entries are covered by a snapshot
+func (j *Journal) Truncate() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// ReplayJournal applies the entries of the journal at filePath to tasks and maxTaskIDs
+// Replaying is idempotent, so entries already covered by the snapshot are harmless.
+// A torn last line, left by a crash in the middle of an append, is ignored.
+// It returns the number of entries applied.
+func ReplayJournal(filePath string, tasks *map[int][]task.Task, maxTaskIDs *map[int]int) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	if *tasks == nil {
+		*tasks = make(map[int][]task.Task)
+	}
+	if *maxTaskIDs == nil {
+		*maxTaskIDs = make(map[int]int)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	applied := 0
+	var pendingErr error
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if pendingErr != nil {
+			return applied, pendingErr
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			pendingErr = fmt.Errorf("journal line %d: %w", lineNumber, err)
+			continue
+		}
+		if err := applyJournalEntry(*tasks, *maxTaskIDs, entry); err != nil {
+			return applied, fmt.Errorf("journal line %d: %w", lineNumber, err)
+		}
+		applied++
+	}
+	if err := scanner.Err(); err != nil {
+		return applied, err
+	}
+	if pendingErr != nil {
+		slog.Warn("Ignoring torn last journal entry", "error", pendingErr)
+	}
+	return applied, nil
+}
+
+func applyJournalEntry(tasks map[int][]task.Task, maxTaskIDs map[int]int, entry journalEntry) error {
+	switch entry.Op {
+	case journalCreate:
+		if entry.Task == nil {
+			return errors.New("missing task")
+		}
+		if !replaceTask(tasks, entry.UserID, *entry.Task) {
+			tasks[entry.UserID] = append(tasks[entry.UserID], *entry.Task)
+		}
+		if entry.Task.ID > maxTaskIDs[entry.UserID] {
+			maxTaskIDs[entry.UserID] = entry.Task.ID
+		}
+	case journalUpdate:
+		if entry.Task == nil {
+			return errors.New("missing task")
+		}
+		// An update of a missing task was rejected by the store when it was recorded
+		replaceTask(tasks, entry.UserID, *entry.Task)
+	case journalDelete:
+		userTasks := tasks[entry.UserID]
+		for i, t := range userTasks {
+			if t.ID == entry.TaskID {
+				tasks[entry.UserID] = append(userTasks[:i:i], userTasks[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Op)
+	}
+	return nil
+}
+
+// replaceTask replaces the task with the same ID and reports whether there was one
+func replaceTask(tasks map[int][]task.Task, userID int, t task.Task) bool {
+	for i, existing := range tasks[userID] {
+		if existing.ID == t.ID {
+			tasks[userID][i] = t
+			return true
+		}
+	}
+	return false
+}
+
+// JournaledStore is a task.Store that records every mutation in a Journal
+// before returning, so the mutations survive a crash between snapshots
+type JournaledStore struct {
+	task.Store
+	journal *Journal
+
+	// checkpointMu is held for reading by mutations and for writing by Checkpoint,
+	// so a snapshot never misses an entry that the truncated journal held
+	checkpointMu sync.RWMutex
+}
+
+// NewJournaledStore wraps store so that every mutation is recorded in journal
+func NewJournaledStore(store task.Store, journal *Journal) *JournaledStore {
+	return &JournaledStore{Store: store, journal: journal}
+}
+
+// Create stores the task and records it in the journal
+// If the journal cannot be written the task is removed again.
+func (s *JournaledStore) Create(userID int, t task.Task) (task.Task, error) {
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	created, err := s.Store.Create(userID, t)
+	if err != nil {
+		return created, err
+	}
+	if err := s.journal.append(journalEntry{Op: journalCreate, UserID: userID, Task: &created}); err != nil {
+		if rollbackErr := s.Store.Delete(userID, created.ID); rollbackErr != nil {
+			slog.Error("Failed to roll back task creation", "UserID", userID, "TaskID", created.ID, "error", rollbackErr)
+		}
+		return task.Task{}, err
+	}
+	return created, nil
+}
+
+// Update records the task in the journal and then stores it
+func (s *JournaledStore) Update(userID int, t task.Task) error {
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	if err := s.journal.append(journalEntry{Op: journalUpdate, UserID: userID, Task: &t}); err != nil {
+		return err
+	}
+	return s.Store.Update(userID, t)
+}
+
+// Delete records the removal in the journal and then removes the task
+func (s *JournaledStore) Delete(userID int, taskID int) error {
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	if err := s.journal.append(journalEntry{Op: journalDelete, UserID: userID, TaskID: taskID}); err != nil {
+		return err
+	}
+	return s.Store.Delete(userID, taskID)
+}
+
+// DueBy returns the open tasks due no later than dueBy(userID) from the wrapped store
+func (s *JournaledStore) DueBy(dueBy func(userID int) time.Time) map[int][]task.Task {
+	return task.DueTasks(s.Store, dueBy)
+}
+
+// Checkpoint passes a snapshot of the store to save and truncates the journal once save succeeds
+// Mutations are blocked while the checkpoint runs.
+func (s *JournaledStore) Checkpoint(save func(tasks map[int][]task.Task, maxTaskIDs map[int]int) error) error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	tasks, maxTaskIDs := s.Store.Snapshot()
+	if err := save(tasks, maxTaskIDs); err != nil {
+		return err
+	}
+	return s.journal.Truncate()
+}
@@ -0,0 +1,121 @@
+package files
+
+import (
+	"fmt"
+	"sort"
+	"todoapp/task"
+)
+
+// currentVersion is the version of the on-disk format written by SaveData
+// Files without a version field are version 0.
+const currentVersion = 2
+
+// migration upgrades data from version from to from+1
+// apply changes data in place and describes every change it made
+type migration struct {
+	description string
+	apply       func(data *dataFormat) []string
+}
+
+// migrations maps the version a migration upgrades from to the migration
+var migrations = map[int]migration{}
+
+// registerMigration adds the migration upgrading data from version from to from+1
+func registerMigration(from int, description string, apply func(data *dataFormat) []string) {
+	if _, exists := migrations[from]; exists {
+		panic(fmt.Sprintf("migration from version %d registered twice", from))
+	}
+	migrations[from] = migration{description: description, apply: apply}
+}
+
+func init() {
+	registerMigration(0, "normalize status strings and backfill status IDs and max task IDs", normalizeStatuses)
+	registerMigration(1, "backfill priorities", backfillPriorities)
+}
+
+// migrate upgrades data to currentVersion and returns a report of every change
+func migrate(data *dataFormat) ([]string, error) {
+	if data.Version > currentVersion {
+		return nil, fmt.Errorf("data version %d is newer than the supported version %d", data.Version, currentVersion)
+	}
+	if data.Tasks == nil {
+		data.Tasks = make(map[int][]task.Task)
+	}
+	if data.MaxTaskIDs == nil {
+		data.MaxTaskIDs = make(map[int]int)
+	}
+
+	var report []string
+	for data.Version < currentVersion {
+		m, ok := migrations[data.Version]
+		if !ok {
+			return report, fmt.Errorf("no migration from data version %d", data.Version)
+		}
+
+		report = append(report, fmt.Sprintf("version %d -> %d: %s", data.Version, data.Version+1, m.description))
+		for _, change := range m.apply(data) {
+			report = append(report, "  "+change)
+		}
+		data.Version++
+	}
+	return report, nil
+}
+
+// sortedUserIDs returns the user IDs of data in ascending order, so reports are stable
+func sortedUserIDs(data *dataFormat) []int {
+	userIDs := make([]int, 0, len(data.Tasks))
+	for userID := range data.Tasks {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+	return userIDs
+}
+
+func normalizeStatuses(data *dataFormat) []string {
+	var changes []string
+	for _, userID := range sortedUserIDs(data) {
+		maxTaskID := 0
+		for i, t := range data.Tasks[userID] {
+			maxTaskID = max(maxTaskID, t.ID)
+
+			statusID, err := task.ParseStatus(t.StatusString)
+			if err != nil {
+				changes = append(changes, fmt.Sprintf("user %d task %d: unknown status %q left unchanged", userID, t.ID, t.StatusString))
+				continue
+			}
+			if t.StatusString != statusID.String() {
+				changes = append(changes, fmt.Sprintf("user %d task %d: status %q -> %q", userID, t.ID, t.StatusString, statusID.String()))
+				data.Tasks[userID][i].StatusString = statusID.String()
+			}
+			if t.StatusID != statusID {
+				changes = append(changes, fmt.Sprintf("user %d task %d: status_id %d -> %d", userID, t.ID, t.StatusID, statusID))
+				data.Tasks[userID][i].StatusID = statusID
+			}
+		}
+
+		if data.MaxTaskIDs[userID] < maxTaskID {
+			changes = append(changes, fmt.Sprintf("user %d: maxTaskID %d -> %d", userID, data.MaxTaskIDs[userID], maxTaskID))
+			data.MaxTaskIDs[userID] = maxTaskID
+		}
+	}
+	return changes
+}
+
+func backfillPriorities(data *dataFormat) []string {
+	var changes []string
+	for _, userID := range sortedUserIDs(data) {
+		for i, t := range data.Tasks[userID] {
+			priorityID, err := task.ParsePriority(t.PriorityString)
+			if err != nil {
+				priorityID = task.DefaultPriority
+			}
+			if t.PriorityID == priorityID && t.PriorityString == priorityID.String() {
+				continue
+			}
+			changes = append(changes, fmt.Sprintf("user %d task %d: priority %q -> %q", userID, t.ID, t.PriorityString, priorityID.String()))
+			data.Tasks[userID][i].PriorityID = priorityID
+			data.Tasks[userID][i].PriorityString = priorityID.String()
+		}
+	}
+	return changes
+}
@@ -0,0 +1,63 @@
+package files
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+	"todoapp/task"
+)
+
+// Snapshotter saves snapshots of a JournaledStore to Filename and truncates its journal
+// The previous Keep snapshots are kept next to Filename for recovery.
+type Snapshotter struct {
+	Store    *JournaledStore
+	Filename string
+	Keep     int
+	// Retention is how long deleted tasks are kept; before every snapshot, Purge is called with
+	// the time before which deleted tasks expire. Zero keeps deleted tasks forever.
+	Retention time.Duration
+	Purge     func(cutoff time.Time) (int, error)
+
+	// mu serializes snapshots, so two of them never rotate the same files at once
+	mu sync.Mutex
+}
+
+// Snapshot saves the current state of the store
+func (s *Snapshotter) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Retention > 0 && s.Purge != nil {
+		// A failed purge is retried with the next snapshot and must not keep this one from being saved
+		purged, err := s.Purge(time.Now().Add(-s.Retention))
+		if err != nil {
+			slog.Error("Failed to purge expired tasks", "error", err)
+		}
+		if purged > 0 {
+			slog.Info("Purged expired tasks", "count", purged, "retention", s.Retention)
+		}
+	}
+
+	return s.Store.Checkpoint(func(tasks map[int][]task.Task, maxTaskIDs map[int]int) error {
+		return SaveSnapshot(s.Filename, s.Keep, tasks, maxTaskIDs)
+	})
+}
+
+// Run saves a snapshot every interval until stop is closed
+func (s *Snapshotter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				slog.Error("Failed to save periodic snapshot", "error", err)
+			} else {
+				slog.Info("Periodic snapshot saved", "file", s.Filename)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
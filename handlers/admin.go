@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// SnapshotHandler returns a handler that saves a snapshot on demand by calling snapshot
+func SnapshotHandler(snapshot func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := snapshot(); err != nil {
+			slog.Error("Failed to save snapshot", "error", err)
+			http.Error(w, "Failed to save snapshot", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// multipartOverhead is the room an upload gets on top of the attachment quota for its multipart framing
+const multipartOverhead = 1 << 20
+
+// sniffLength is the number of bytes http.DetectContentType looks at
+const sniffLength = 512
+
+// GetAttachmentsHandler returns the attachments of the task in the path, oldest first
+func GetAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.AttachmentsRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Attachments)
+}
+
+// AddAttachmentHandler stores the "file" part of a multipart/form-data body and attaches it to the task in the path
+// The upload is streamed to the blob store and its content type is sniffed from the first bytes.
+func AddAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	if quota := task.AttachmentQuota(); quota > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, quota+multipartOverhead)
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+	part, err := nextFilePart(reader)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	defer part.Close()
+
+	content := bufio.NewReaderSize(part, sniffLength)
+	head, err := content.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeUploadError(w, err)
+		return
+	}
+	digest, size, err := task.GetBlobStore().Put(userID, content)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.AddAttachmentRequest,
+		TaskID: taskID,
+		Attachment: task.Attachment{
+			Name:        part.FileName(),
+			ContentType: http.DetectContentType(head),
+			Size:        size,
+			SHA256:      digest,
+		},
+	})
+	if !ok {
+		// The content may never be attached, so it must not keep counting towards the quota
+		task.ReleaseBlob(userID, digest)
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res.Attachments[0])
+}
+
+// errNoFile is returned by nextFilePart for a body without a "file" part
+var errNoFile = errors.New("the body has no file part")
+
+// nextFilePart returns the "file" part of a multipart body
+func nextFilePart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errNoFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// writeUploadError writes the status matching an error reading or storing an upload
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, task.ErrQuotaExceeded.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errNoFile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("Failed to store attachment", "error", err)
+		http.Error(w, "Failed to store attachment", http.StatusInternalServerError)
+	}
+}
+
+// DownloadAttachmentHandler streams the content of the attachment in the path
+func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, attachmentID, err := attachmentIDsFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.AttachmentsRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	var attachment *task.Attachment
+	for i := range res.Attachments {
+		if res.Attachments[i].ID == attachmentID {
+			attachment = &res.Attachments[i]
+		}
+	}
+	if attachment == nil {
+		http.Error(w, task.ErrAttachmentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	content, err := task.GetBlobStore().Open(userID, attachment.SHA256)
+	if errors.Is(err, task.ErrBlobNotFound) {
+		http.Error(w, task.ErrAttachmentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to open attachment", "UserID", userID, "digest", attachment.SHA256, "error", err)
+		http.Error(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, content); err != nil {
+		slog.Error("Failed to send attachment", "UserID", userID, "digest", attachment.SHA256, "error", err)
+	}
+}
+
+// RemoveAttachmentHandler removes the attachment in the path
+func RemoveAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, attachmentID, err := attachmentIDsFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:       userID,
+		Action:       task.RemoveAttachmentRequest,
+		TaskID:       taskID,
+		AttachmentID: attachmentID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachmentIDsFromPath returns the {id} and {attachmentID} of the path
+func attachmentIDsFromPath(r *http.Request) (int, int, error) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		return 0, 0, errors.New("Invalid task ID")
+	}
+	attachmentID, err := strconv.Atoi(r.PathValue("attachmentID"))
+	if err != nil {
+		return 0, 0, errors.New("Invalid attachment ID")
+	}
+	return taskID, attachmentID, nil
+}
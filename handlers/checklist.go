@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// checklistItemBody is the request body of AddChecklistItemHandler
+type checklistItemBody struct {
+	Text string `json:"text"`
+}
+
+// moveBody is the request body of MoveChecklistItemHandler
+type moveBody struct {
+	Position int `json:"position"`
+}
+
+// AddChecklistItemHandler appends the item in the body to the checklist of a task
+func AddChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var body checklistItemBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	changeChecklist(w, r, task.Request{Action: task.AddChecklistItemRequest, ItemText: body.Text})
+}
+
+// ToggleChecklistItemHandler checks or unchecks the {itemID} of the path
+func ToggleChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "Invalid checklist item ID", http.StatusBadRequest)
+		return
+	}
+	changeChecklist(w, r, task.Request{Action: task.ToggleChecklistItemRequest, ItemID: itemID})
+}
+
+// MoveChecklistItemHandler moves the {itemID} of the path to the position in the body
+func MoveChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "Invalid checklist item ID", http.StatusBadRequest)
+		return
+	}
+	var body moveBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	changeChecklist(w, r, task.Request{Action: task.MoveChecklistItemRequest, ItemID: itemID, Position: body.Position})
+}
+
+// RemoveChecklistItemHandler removes the {itemID} of the path from the checklist of a task
+func RemoveChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "Invalid checklist item ID", http.StatusBadRequest)
+		return
+	}
+	changeChecklist(w, r, task.Request{Action: task.RemoveChecklistItemRequest, ItemID: itemID})
+}
+
+// changeChecklist submits a request changing the checklist of the task in the path and writes the updated task
+func changeChecklist(w http.ResponseWriter, r *http.Request, request task.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	request.UserID = userID
+	request.TaskID = taskID
+	request.IfMatch = ifMatch
+	res, ok := submit(w, r, request)
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", etag(res.Tasks[0]))
+	writeJSON(w, http.StatusOK, res.Tasks[0])
+}
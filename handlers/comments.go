@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// commentBody is the request body of AddCommentHandler and UpdateCommentHandler
+type commentBody struct {
+	Body string `json:"body"`
+}
+
+// GetCommentsHandler returns the comments of the task in the path, oldest first
+func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.CommentsRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Comments)
+}
+
+// AddCommentHandler adds the comment in the body to the task in the path and writes it
+func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var body commentBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:  userID,
+		Action:  task.AddCommentRequest,
+		TaskID:  taskID,
+		Comment: body.Body,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res.Comments[0])
+}
+
+// UpdateCommentHandler replaces the body of the comment in the path and writes it
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, commentID, err := commentIDsFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body commentBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:    userID,
+		Action:    task.UpdateCommentRequest,
+		TaskID:    taskID,
+		CommentID: commentID,
+		Comment:   body.Body,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Comments[0])
+}
+
+// DeleteCommentHandler removes the comment in the path
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, commentID, err := commentIDsFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:    userID,
+		Action:    task.DeleteCommentRequest,
+		TaskID:    taskID,
+		CommentID: commentID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentIDsFromPath returns the {id} and {commentID} of the path
+func commentIDsFromPath(r *http.Request) (int, int, error) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		return 0, 0, errors.New("Invalid task ID")
+	}
+	commentID, err := strconv.Atoi(r.PathValue("commentID"))
+	if err != nil {
+		return 0, 0, errors.New("Invalid comment ID")
+	}
+	return taskID, commentID, nil
+}
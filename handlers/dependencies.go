@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// GraphHandler returns the dependency graph of the user's tasks
+func GraphHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.GraphRequest,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Graph)
+}
+
+// NextHandler returns the open tasks of the user that no open task blocks, most pressing first
+func NextHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.NextRequest,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Tasks)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// EstimatesHandler compares the estimated, actual and remaining effort of the tasks of the user per unit
+func EstimatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.EstimatesRequest,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Estimates)
+}
+
+// BurndownHandler returns the effort left on the tasks of the user at the end of every day
+// It takes the from, to and unit query parameters.
+func BurndownHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := task.ParseBurndownOptions(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:   userID,
+		Action:   task.BurndownRequest,
+		Burndown: opts,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Burndown)
+}
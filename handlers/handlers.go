@@ -3,12 +3,126 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"todoapp/middleware"
 	"todoapp/task"
 )
 
+// retryAfterSeconds is sent in the Retry-After header when a request timed out
+const retryAfterSeconds = "1"
+
+// nextCursorHeader carries the cursor of the next page of a task listing
+const nextCursorHeader = "X-Next-Cursor"
+
+// submit sends the request to the task actor and waits for its response
+// If the request could not be served in time, it writes the error response and returns false
+func submit(w http.ResponseWriter, r *http.Request, request task.Request) (task.Response, bool) {
+	request.TraceID = middleware.GetTraceID(r.Context())
+	res, err := task.Submit(r.Context(), request)
+	switch {
+	case err == nil:
+		return res, true
+	case errors.Is(err, task.ErrQueueTimeout):
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+	case errors.Is(err, task.ErrResponseTimeout):
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		http.Error(w, "Timed out waiting for the task service. Please try again later.", http.StatusGatewayTimeout)
+	default:
+		slog.Info("Request abandoned by the client", "TraceID", middleware.GetTraceID(r.Context()), "error", err)
+		http.Error(w, "Request canceled.", http.StatusServiceUnavailable)
+	}
+	return res, false
+}
+
+// taskIDFromPath extracts the task ID from the {id} wildcard of the route,
+// or from the legacy /delete/{id} path
+func taskIDFromPath(r *http.Request) (int, error) {
+	idString := r.PathValue("id")
+	if idString == "" {
+		idString = strings.TrimPrefix(r.URL.Path, "/delete/")
+	}
+	return strconv.Atoi(idString)
+}
+
+// writeJSON encodes value as the JSON body of a response with the given status
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+// etag formats the revision of a task as a strong entity tag
+func etag(t task.Task) string {
+	return `"` + strconv.Itoa(t.Revision) + `"`
+}
+
+// parseIfMatch extracts the revisions listed in the If-Match header
+// An absent header or "*" imposes no condition; weak tags never match
+func parseIfMatch(r *http.Request) ([]int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	revisions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		revision, err := strconv.Atoi(strings.Trim(tag, `"`))
+		if err != nil {
+			return nil, errors.New("invalid If-Match header")
+		}
+		revisions = append(revisions, revision)
+	}
+	if len(revisions) == 0 {
+		// Only weak tags were sent, which a strong comparison never matches
+		revisions = append(revisions, -1)
+	}
+	return revisions, nil
+}
+
+// writeTaskError writes the response for an error returned by the task actor
+// Errors without a more specific status are written with fallbackStatus
+func writeTaskError(w http.ResponseWriter, err error, fallbackStatus int) {
+	var mismatch *task.RevisionMismatchError
+	var transition *task.TransitionError
+	switch {
+	case errors.Is(err, task.ErrTaskNotFound), errors.Is(err, task.ErrCommentNotFound),
+		errors.Is(err, task.ErrChecklistItemNotFound), errors.Is(err, task.ErrAttachmentNotFound),
+		errors.Is(err, task.ErrTimeEntryNotFound), errors.Is(err, task.ErrNoTimer):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, task.ErrHasChildren), errors.Is(err, task.ErrBlocked), errors.Is(err, task.ErrNotDeleted),
+		errors.Is(err, task.ErrTimerRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, task.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, task.ErrHistoryNotRecorded):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case errors.As(err, &transition):
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":   err.Error(),
+			"allowed": transition.Allowed,
+		})
+	case errors.As(err, &mismatch):
+		w.Header().Set("ETag", etag(mismatch.Current))
+		writeJSON(w, http.StatusPreconditionFailed, map[string]any{
+			"error":   err.Error(),
+			"current": mismatch.Current,
+		})
+	default:
+		http.Error(w, err.Error(), fallbackStatus)
+	}
+}
+
 // CreateHandler handles task creation
 func CreateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -29,27 +143,27 @@ func CreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := make(chan task.Response, 1)
-	request := task.Request{
-		UserID:   userID,
-		Action:   task.CreateRequest,
-		Task:     taskToBeCreated,
-		Response: response,
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.CreateRequest,
+		Task:   taskToBeCreated,
+	})
+	if !ok {
+		return
 	}
-	select {
-	case task.RequestsChan <- request:
-		res := <-response
-		if res.Error != nil {
-			http.Error(w, res.Error.Error(), http.StatusBadRequest)
-			return
-		}
-		w.WriteHeader(http.StatusCreated)
-	default:
-		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
 	}
+
+	created := res.Tasks[0]
+	w.Header().Set("Location", "/tasks/"+strconv.Itoa(created.ID))
+	w.Header().Set("ETag", etag(created))
+	writeJSON(w, http.StatusCreated, created)
 }
 
 // GetHandler handles retrieving tasks
+// The query parameters filter, sort and page the list, see task.ParseListOptions
 func GetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
@@ -62,32 +176,81 @@ func GetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := make(chan task.Response, 1)
-	request := task.Request{
-		UserID:   userID,
-		Action:   task.GetRequest,
-		Response: response,
+	listOptions, err := task.ParseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	select {
-	case task.RequestsChan <- request:
-		res := <-response
-		if res.Error != nil {
-			http.Error(w, res.Error.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		err := json.NewEncoder(w).Encode(res.Tasks)
-		if err != nil {
-			http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.GetRequest,
+		List:   listOptions,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		var fieldErr *task.FieldError
+		if errors.As(res.Error, &fieldErr) || errors.Is(res.Error, task.ErrInvalidCursor) {
+			http.Error(w, res.Error.Error(), http.StatusBadRequest)
 			return
 		}
-	default:
-		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if listOptions.Tree {
+		writeJSON(w, http.StatusOK, res.Tree)
+		return
+	}
+	if res.Next != "" {
+		w.Header().Set(nextCursorHeader, res.Next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res.Tasks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 }
 
+// GetTaskHandler handles retrieving a single task
+func GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.GetTaskRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag(res.Tasks[0]))
+	writeJSON(w, http.StatusOK, res.Tasks[0])
+}
+
 // UpdateHandler handles task updates
+// On /tasks/{id} the task ID comes from the path, on the legacy /update route from the body
 func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
@@ -101,78 +264,151 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy /update route has no ID in the path and keeps the fields its clients leave out
+	legacy := r.PathValue("id") == ""
+	if !legacy {
+		taskID, err := taskIDFromPath(r)
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+		if taskToBeUpdated.ID != 0 && taskToBeUpdated.ID != taskID {
+			http.Error(w, "Task ID in the body does not match the path", http.StatusBadRequest)
+			return
+		}
+		taskToBeUpdated.ID = taskID
+	}
+
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	userID, err := middleware.GetUserID(r.Context())
 	if err != nil {
 		http.Error(w, "UserID is required", http.StatusBadRequest)
 		return
 	}
 
-	response := make(chan task.Response, 1)
-	request := task.Request{
-		UserID:   userID,
-		Action:   task.UpdateRequest,
-		Task:     taskToBeUpdated,
-		Response: response,
+	res, ok := submit(w, r, task.Request{
+		UserID:  userID,
+		Action:  task.UpdateRequest,
+		Task:    taskToBeUpdated,
+		IfMatch: ifMatch,
+		Merge:   legacy,
+	})
+	if !ok {
+		return
 	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", etag(res.Tasks[0]))
+	writeJSON(w, http.StatusOK, res.Tasks[0])
+}
 
-	select {
-	case task.RequestsChan <- request:
-		res := <-response
-		if res.Error != nil {
-			if errors.Is(res.Error, task.ErrTaskNotFound) {
-				http.Error(w, res.Error.Error(), http.StatusNotFound)
-				return
-			}
-			http.Error(w, res.Error.Error(), http.StatusBadRequest)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-	default:
-		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+// PatchHandler handles partial task updates with JSON Merge Patch semantics
+// Only the fields present in the body are changed
+func PatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
 	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	patch, err := task.ParsePatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:  userID,
+		Action:  task.PatchRequest,
+		TaskID:  taskID,
+		Patch:   patch,
+		IfMatch: ifMatch,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", etag(res.Tasks[0]))
+	writeJSON(w, http.StatusOK, res.Tasks[0])
 }
 
 // DeleteHandler handles task deletion
+// The children query parameter decides what happens to the subtasks, see task.ParseChildPolicy
 func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Invalid HTTP method.", http.StatusMethodNotAllowed)
 		return
 	}
 
-	path := r.URL.Path
-	taskID, err := strconv.Atoi(path[len("/delete/"):])
+	taskID, err := taskIDFromPath(r)
 	if err != nil {
 		http.Error(w, "Invalid task ID", http.StatusBadRequest)
 		return
 	}
 
+	childPolicy, err := task.ParseChildPolicy(r.URL.Query().Get("children"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	userID, err := middleware.GetUserID(r.Context())
 	if err != nil {
 		http.Error(w, "UserID is required", http.StatusBadRequest)
 		return
 	}
 
-	response := make(chan task.Response, 1)
-	request := task.Request{
-		UserID:   userID,
-		Action:   task.DeleteRequest,
-		TaskID:   taskID,
-		Response: response,
+	res, ok := submit(w, r, task.Request{
+		UserID:      userID,
+		Action:      task.DeleteRequest,
+		TaskID:      taskID,
+		ChildPolicy: childPolicy,
+		IfMatch:     ifMatch,
+	})
+	if !ok {
+		return
 	}
-
-	select {
-	case task.RequestsChan <- request:
-		res := <-response
-		if res.Error != nil {
-			if errors.Is(res.Error, task.ErrTaskNotFound) {
-				http.Error(w, res.Error.Error(), http.StatusNotFound)
-				return
-			}
-			http.Error(w, res.Error.Error(), http.StatusBadRequest)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-	default:
-		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
 	}
+	w.WriteHeader(http.StatusOK)
 }
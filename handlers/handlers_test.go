@@ -3,14 +3,19 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 	"todoapp/middleware"
 	"todoapp/task"
 )
@@ -61,7 +66,7 @@ func BenchmarkUpdateHandlerActor_NoParallel(b *testing.B) {
 	task.InitChannel(channelSizeBenchmark)
 
 	response := make(chan task.Response, 1)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID: 1,
 		Action: task.CreateRequest,
 		Task: task.Task{
@@ -70,7 +75,7 @@ func BenchmarkUpdateHandlerActor_NoParallel(b *testing.B) {
 			StatusString: "NotStarted",
 		},
 		Response: response,
-	}
+	})
 	<-response
 
 	updatedTask := task.Task{
@@ -100,7 +105,7 @@ func BenchmarkUpdateHandlerActor(b *testing.B) {
 	task.InitChannel(channelSizeBenchmark)
 
 	response := make(chan task.Response, 1)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID: 1,
 		Action: task.CreateRequest,
 		Task: task.Task{
@@ -109,7 +114,7 @@ func BenchmarkUpdateHandlerActor(b *testing.B) {
 			StatusString: "NotStarted",
 		},
 		Response: response,
-	}
+	})
 	<-response
 
 	updatedTask := task.Task{
@@ -198,17 +203,31 @@ func BenchmarkCreateHandlerActor(b *testing.B) {
 	})
 }
 
+// stallActor blocks the actor started by task.InitChannel on a response nobody reads
+// It returns a function that releases the actor again
+func stallActor() func() {
+	stalled := make(chan task.Response)
+	task.Send(task.Request{
+		UserID:   1,
+		Action:   task.GetRequest,
+		Response: stalled,
+	})
+	return func() { <-stalled }
+}
+
 func TestCreateHandler_ServiceUnavailable(t *testing.T) {
-	mockRequestsChan := make(chan task.Request, 1)
-	task.RequestsChan = mockRequestsChan
+	task.InitChannel(1)
+	task.SetSubmitTimeout(20 * time.Millisecond)
+	defer task.SetSubmitTimeout(task.DefaultSubmitTimeout)
 
-	response := make(chan task.Response, 1)
-	mockRequestsChan <- task.Request{
+	// Stall the actor until the test ends, then fill its queue
+	defer stallActor()()
+	task.Send(task.Request{
 		UserID:   1,
 		Action:   task.CreateRequest,
 		Task:     task.Task{Title: "Mock Task"},
-		Response: response,
-	}
+		Response: make(chan task.Response, 1),
+	})
 
 	req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(`{"title": "New Task", "description": "Task", "status": "NotStarted"}`))
 	req = addUserIDToContext(req, 1)
@@ -222,6 +241,91 @@ func TestCreateHandler_ServiceUnavailable(t *testing.T) {
 	if resp.StatusCode != http.StatusServiceUnavailable {
 		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
 	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+}
+
+func TestAddAttachmentHandler_ServiceUnavailable(t *testing.T) {
+	task.InitChannel(1)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	blobs := task.NewMemoryBlobs()
+	task.SetBlobStore(blobs)
+	task.SetSubmitTimeout(20 * time.Millisecond)
+	defer task.SetSubmitTimeout(task.DefaultSubmitTimeout)
+
+	// Stall the actor and fill its queue, so the upload is stored but never attached
+	release := stallActor()
+	task.Send(task.Request{UserID: 1, Action: task.GetRequest, Response: make(chan task.Response, 1)})
+
+	content := []byte("never attached")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	req := newUploadRequest(t, "/tasks/1/attachments", "notes.txt", content)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+	AddAttachmentHandler(rec, addUserIDToContext(req, 1))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	}
+
+	if ok, _ := blobs.Has(1, digest); !ok {
+		t.Fatal("Expected the content to be stored while the actor is stalled")
+	}
+
+	// Once the actor catches up the content is released
+	release()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if ok, _ := blobs.Has(1, digest); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the content of the failed upload to be deleted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCreateHandler_GatewayTimeout(t *testing.T) {
+	task.InitChannel(10)
+	task.SetSubmitTimeout(20 * time.Millisecond)
+	defer task.SetSubmitTimeout(task.DefaultSubmitTimeout)
+
+	// The queue has room, but the stalled actor never answers
+	defer stallActor()()
+
+	// The create is applied once the actor is released, so it must not touch user 1
+	req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(`{"title": "New Task", "description": "Task", "status": "NotStarted"}`))
+	req = addUserIDToContext(req, 99)
+	w := httptest.NewRecorder()
+
+	CreateHandler(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+}
+
+func TestSubmit_Canceled(t *testing.T) {
+	task.InitChannel(10)
+	defer stallActor()()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := task.Submit(ctx, task.Request{UserID: 1, Action: task.GetRequest})
+	if !errors.Is(err, task.ErrCanceled) {
+		t.Errorf("Expected ErrCanceled, got %v", err)
+	}
 }
 
 func TestCreateHandler_Parallel(t *testing.T) {
@@ -303,11 +407,11 @@ func TestCreateHandler_Goroutine_Parallel(t *testing.T) {
 	wg.Wait()
 
 	response := make(chan task.Response, 1)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID:   1,
 		Action:   task.GetRequest,
 		Response: response,
-	}
+	})
 
 	res := <-response
 	if len(res.Tasks) != numRequests {
@@ -433,7 +537,7 @@ func TestTaskActor_Concurrency(t *testing.T) {
 			defer wg.Done()
 
 			response := make(chan task.Response)
-			task.RequestsChan <- task.Request{
+			task.Send(task.Request{
 				UserID: 1,
 				Action: task.CreateRequest,
 				Task: task.Task{
@@ -442,7 +546,7 @@ func TestTaskActor_Concurrency(t *testing.T) {
 					StatusString: "NotStarted",
 				},
 				Response: response,
-			}
+			})
 
 			if res := <-response; res.Error != nil {
 				t.Errorf("Failed to add task: %v", res.Error)
@@ -453,11 +557,11 @@ func TestTaskActor_Concurrency(t *testing.T) {
 	wg.Wait()
 
 	response := make(chan task.Response)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID:   1,
 		Action:   task.GetRequest,
 		Response: response,
-	}
+	})
 
 	res := <-response
 	if len(res.Tasks) != numGoroutines {
@@ -474,7 +578,7 @@ func TestTaskActor_ConcurrentUpdate(t *testing.T) {
 	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
 
 	response := make(chan task.Response, 1)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID: 1,
 		Action: task.CreateRequest,
 		Task: task.Task{
@@ -483,7 +587,7 @@ func TestTaskActor_ConcurrentUpdate(t *testing.T) {
 			StatusString: "NotStarted",
 		},
 		Response: response,
-	}
+	})
 	if res := <-response; res.Error != nil {
 		t.Fatalf("Failed to create task: %v", res.Error)
 	}
@@ -494,7 +598,7 @@ func TestTaskActor_ConcurrentUpdate(t *testing.T) {
 			defer wg.Done()
 
 			response := make(chan task.Response, 1)
-			task.RequestsChan <- task.Request{
+			task.Send(task.Request{
 				UserID: 1,
 				Action: task.UpdateRequest,
 				Task: task.Task{
@@ -504,7 +608,7 @@ func TestTaskActor_ConcurrentUpdate(t *testing.T) {
 					StatusString: "Started",
 				},
 				Response: response,
-			}
+			})
 
 			if res := <-response; res.Error != nil {
 				t.Errorf("Failed to update task: %v", res.Error)
@@ -515,11 +619,11 @@ func TestTaskActor_ConcurrentUpdate(t *testing.T) {
 	wg.Wait()
 
 	response = make(chan task.Response, 1)
-	task.RequestsChan <- task.Request{
+	task.Send(task.Request{
 		UserID:   1,
 		Action:   task.GetRequest,
 		Response: response,
-	}
+	})
 
 	res := <-response
 	if len(res.Tasks) != 1 {
@@ -656,6 +760,836 @@ func TestDeleteHandler(t *testing.T) {
 	}
 }
 
+// newTestMux registers the task routes on a new mux, serving every request as user 1
+func newTestMux(legacy bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, legacy, func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, addUserIDToContext(r, 1))
+		})
+	})
+	return mux
+}
+
+func TestRESTRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted"}`, http.StatusCreated},
+		{"list", http.MethodGet, "/tasks", "", http.StatusOK},
+		{"get single task", http.MethodGet, "/tasks/1", "", http.StatusOK},
+		{"get missing task", http.MethodGet, "/tasks/2", "", http.StatusNotFound},
+		{"get invalid task ID", http.MethodGet, "/tasks/abc", "", http.StatusBadRequest},
+		{"update", http.MethodPut, "/tasks/1", `{"title": "Updated Task 1", "status": "Started"}`, http.StatusOK},
+		{"update with mismatching ID", http.MethodPut, "/tasks/1", `{"id": 2, "title": "Task", "status": "Started"}`, http.StatusBadRequest},
+		{"patch", http.MethodPatch, "/tasks/1", `{"status": "Completed"}`, http.StatusOK},
+		{"patch read-only field", http.MethodPatch, "/tasks/1", `{"id": 5}`, http.StatusBadRequest},
+		{"patch invalid status", http.MethodPatch, "/tasks/1", `{"status": "Done"}`, http.StatusBadRequest},
+		{"patch missing task", http.MethodPatch, "/tasks/2", `{"title": "Task 2"}`, http.StatusNotFound},
+		{"method not allowed", http.MethodPost, "/tasks/1", "", http.StatusMethodNotAllowed},
+		{"delete", http.MethodDelete, "/tasks/1", "", http.StatusOK},
+		{"get deleted task", http.MethodGet, "/tasks/1", "", http.StatusNotFound},
+		{"legacy route disabled", http.MethodPost, "/create", `{"title": "Task 2", "status": "NotStarted"}`, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.data))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCreateHandler_ReturnsCreatedTask(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+
+	rec := httptest.NewRecorder()
+	newTestMux(true).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(`{"title": "Task 1", "status": "NotStarted"}`)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if location := rec.Header().Get("Location"); location != "/tasks/1" {
+		t.Errorf("Expected Location /tasks/1, got %q", location)
+	}
+
+	var created task.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if created.ID != 1 || created.Title != "Task 1" {
+		t.Errorf("Unexpected created task: %+v", created)
+	}
+}
+
+func TestLegacyUpdateKeepsOmittedFields(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(true)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(
+		`{"title": "Task 1", "status": "NotStarted", "priority": "High", "tags": ["work"], "due_date": "2030-01-02T00:00:00Z", "estimate": 2, "estimate_unit": "hours"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/update", strings.NewReader(`{"id": 1, "title": "Renamed", "status": "Started"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	var updated task.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if updated.Title != "Renamed" || updated.StatusString != "Started" {
+		t.Errorf("Expected the title and status to change, got %+v", updated)
+	}
+	if updated.PriorityString != "High" || len(updated.Tags) != 1 || updated.Tags[0] != "work" {
+		t.Errorf("Expected the priority and tags to be kept, got %q and %v", updated.PriorityString, updated.Tags)
+	}
+	if updated.DueDate == nil || !updated.DueDate.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the due date to be kept, got %v", updated.DueDate)
+	}
+	if updated.Estimate != 2 || updated.EstimateUnit != "hours" {
+		t.Errorf("Expected the estimate to be kept, got %v %q", updated.Estimate, updated.EstimateUnit)
+	}
+}
+
+func TestGetHandler_Paging(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	for _, status := range []string{"NotStarted", "Started", "NotStarted", "Completed"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title": "Task", "status": "`+status+`"}`)))
+	}
+
+	var ids []int
+	url := "/tasks?status=NotStarted,Started&order=desc&limit=2"
+	for page := 0; url != ""; page++ {
+		if page > 2 {
+			t.Fatal("Expected paging to end")
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		var tasks []task.Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+			t.Fatalf("failed to parse response body: %v", err)
+		}
+		for _, tk := range tasks {
+			ids = append(ids, tk.ID)
+		}
+
+		url = ""
+		if next := rec.Header().Get("X-Next-Cursor"); next != "" {
+			url = "/tasks?status=NotStarted,Started&order=desc&limit=2&cursor=" + next
+		}
+	}
+	if fmt.Sprint(ids) != "[3 2 1]" {
+		t.Errorf("Expected tasks [3 2 1] across pages, got %v", ids)
+	}
+
+	for _, query := range []string{"sort=color", "limit=x", "cursor=garbage"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestTagRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create with tags", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted", "tags": ["work"]}`, http.StatusCreated, `"tags":["work"]`},
+		{"add tags", http.MethodPost, "/tasks/1/tags", `{"tags": ["Backend", "urgent"]}`, http.StatusOK, `"tags":["backend","urgent","work"]`},
+		{"add invalid tag", http.MethodPost, "/tasks/1/tags", `{"tags": [""]}`, http.StatusBadRequest, ""},
+		{"add tags to missing task", http.MethodPost, "/tasks/2/tags", `{"tags": ["work"]}`, http.StatusNotFound, ""},
+		{"remove tag", http.MethodDelete, "/tasks/1/tags/urgent", "", http.StatusOK, `"tags":["backend","work"]`},
+		{"filter by tag", http.MethodGet, "/tasks?tags_all=backend,work", "", http.StatusOK, `"id":1`},
+		{"tag counts", http.MethodGet, "/tags", "", http.StatusOK, `[{"tag":"backend","count":1},{"tag":"work","count":1}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSubtaskRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create parent", http.MethodPost, "/tasks", `{"title": "Parent", "status": "Started"}`, http.StatusCreated, `"parent_id":0`},
+		{"create subtask", http.MethodPost, "/tasks", `{"title": "Child", "status": "Completed", "parent_id": 1}`, http.StatusCreated, `"parent_id":1`},
+		{"create subtask of missing task", http.MethodPost, "/tasks", `{"title": "Orphan", "status": "Started", "parent_id": 9}`, http.StatusBadRequest, ""},
+		{"create cycle", http.MethodPatch, "/tasks/1", `{"parent_id": 2}`, http.StatusBadRequest, ""},
+		{"tree view", http.MethodGet, "/tasks?view=tree", "", http.StatusOK, `"progress":{"completed":1,"total":1,"percent":100},"children":[{"id":2`},
+		{"paged tree view", http.MethodGet, "/tasks?view=tree&limit=1", "", http.StatusBadRequest, ""},
+		{"invalid child policy", http.MethodDelete, "/tasks/1?children=orphan", "", http.StatusBadRequest, ""},
+		{"restrict delete", http.MethodDelete, "/tasks/1?children=restrict", "", http.StatusConflict, ""},
+		{"cascade delete", http.MethodDelete, "/tasks/1?children=cascade", "", http.StatusOK, ""},
+		{"subtask deleted", http.MethodGet, "/tasks/2", "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDependencyRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create blocker", http.MethodPost, "/tasks", `{"title": "Design", "status": "Started"}`, http.StatusCreated, ""},
+		{"create blocked task", http.MethodPost, "/tasks", `{"title": "Build", "status": "NotStarted", "blocked_by": [1]}`, http.StatusCreated, `"blocked_by":[1]`},
+		{"create completed blocked task", http.MethodPost, "/tasks", `{"title": "Ship", "status": "Completed", "blocked_by": [2]}`, http.StatusConflict, ""},
+		{"complete blocked task", http.MethodPatch, "/tasks/2", `{"status": "Completed"}`, http.StatusConflict, "tasks [1] are open"},
+		{"unknown blocker", http.MethodPatch, "/tasks/2", `{"blocked_by": [7]}`, http.StatusBadRequest, ""},
+		{"graph", http.MethodGet, "/tasks/graph", "", http.StatusOK, `"edges":[{"from":1,"to":2}],"order":[1,2]`},
+		{"next", http.MethodGet, "/tasks/next", "", http.StatusOK, `"id":1`},
+		{"complete blocker", http.MethodPatch, "/tasks/1", `{"status": "Completed"}`, http.StatusOK, ""},
+		{"complete unblocked task", http.MethodPatch, "/tasks/2", `{"status": "Completed"}`, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRecurrenceRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create recurring task", http.MethodPost, "/tasks", `{"title": "Report", "status": "NotStarted", "due_date": "2030-01-07T09:00:00Z", "recurrence": "freq=weekly;byday=mo,th"}`, http.StatusCreated, `"recurrence":"FREQ=WEEKLY;BYDAY=MO,TH"`},
+		{"invalid rule", http.MethodPost, "/tasks", `{"title": "Report", "status": "NotStarted", "due_date": "2030-01-07T09:00:00Z", "recurrence": "FREQ=HOURLY"}`, http.StatusBadRequest, "recurrence"},
+		{"rule without due date", http.MethodPatch, "/tasks/1", `{"due_date": null}`, http.StatusBadRequest, "due date"},
+		{"complete occurrence", http.MethodPatch, "/tasks/1", `{"status": "Completed"}`, http.StatusOK, `"next_occurrence":2`},
+		{"next occurrence", http.MethodGet, "/tasks/2", "", http.StatusOK, `"due_date":"2030-01-10T09:00:00Z"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWorkflowRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	err := task.SetWorkflowConfig(task.WorkflowConfig{
+		Workflows: map[string]*task.Workflow{
+			"review": {
+				States: []task.WorkflowState{
+					{Name: "Open", Category: "NotStarted"},
+					{Name: "InReview", Category: "Started"},
+					{Name: "Done", Category: "Completed"},
+				},
+				Transitions: map[string][]string{
+					"Open":     {"InReview"},
+					"InReview": {"Open", "Done"},
+				},
+			},
+		},
+		Default: "review",
+	})
+	if err != nil {
+		t.Fatalf("SetWorkflowConfig failed: %v", err)
+	}
+	defer task.SetWorkflowConfig(task.WorkflowConfig{})
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"workflow", http.MethodGet, "/workflow", "", http.StatusOK, `"transitions":{"InReview":["Open","Done"],"Open":["InReview"]}`},
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "Open"}`, http.StatusCreated, `"status":"Open"`},
+		{"unknown status", http.MethodPost, "/tasks", `{"title": "Task 2", "status": "Started"}`, http.StatusBadRequest, "expected one of Open, InReview, Done"},
+		{"illegal transition", http.MethodPatch, "/tasks/1", `{"status": "Done"}`, http.StatusConflict, `"allowed":["InReview"]`},
+		{"illegal update", http.MethodPut, "/tasks/1", `{"title": "Task 1", "status": "Done"}`, http.StatusConflict, `"allowed":["InReview"]`},
+		{"transition", http.MethodPatch, "/tasks/1", `{"status": "InReview"}`, http.StatusOK, `"status_id":2`},
+		{"filter", http.MethodGet, "/tasks?status=InReview", "", http.StatusOK, `"id":1`},
+		{"unknown filter", http.MethodGet, "/tasks?status=Started", "", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTrashRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted"}`, http.StatusCreated, ""},
+		{"create another", http.MethodPost, "/tasks", `{"title": "Task 2", "status": "NotStarted"}`, http.StatusCreated, ""},
+		{"purge open task", http.MethodDelete, "/trash/1", "", http.StatusConflict, "not deleted"},
+		{"delete", http.MethodDelete, "/tasks/1", "", http.StatusOK, ""},
+		{"delete another", http.MethodDelete, "/tasks/2", "", http.StatusOK, ""},
+		{"trash", http.MethodGet, "/trash", "", http.StatusOK, `"deleted":true`},
+		{"update deleted", http.MethodPut, "/tasks/1", `{"title": "Edited", "status": "NotStarted"}`, http.StatusNotFound, ""},
+		{"restore", http.MethodPost, "/trash/1/restore", "", http.StatusOK, `"deleted":false`},
+		{"restored task", http.MethodGet, "/tasks/1", "", http.StatusOK, `"title":"Task 1"`},
+		{"restore again", http.MethodPost, "/trash/1/restore", "", http.StatusConflict, ""},
+		{"purge", http.MethodDelete, "/trash/2", "", http.StatusNoContent, ""},
+		{"purge again", http.MethodDelete, "/trash/2", "", http.StatusNotFound, ""},
+		{"empty trash", http.MethodGet, "/trash", "", http.StatusOK, "[]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestChecklistRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted", "checklist": [{"text": "Pack"}], "checklist_auto_complete": true}`, http.StatusCreated, `"checklist":[{"id":1,"text":"Pack","done":false}]`},
+		{"add", http.MethodPost, "/tasks/1/checklist", `{"text": "Go"}`, http.StatusOK, `"checklist_progress":{"completed":0,"total":2,"percent":0}`},
+		{"add empty", http.MethodPost, "/tasks/1/checklist", `{"text": ""}`, http.StatusBadRequest, "text"},
+		{"move", http.MethodPost, "/tasks/1/checklist/2/move", `{"position": 0}`, http.StatusOK, `"checklist":[{"id":2,"text":"Go","done":false},{"id":1`},
+		{"toggle", http.MethodPost, "/tasks/1/checklist/1/toggle", "", http.StatusOK, `"percent":50`},
+		{"toggle unknown item", http.MethodPost, "/tasks/1/checklist/9/toggle", "", http.StatusNotFound, "checklist item not found"},
+		{"invalid item ID", http.MethodPost, "/tasks/1/checklist/x/toggle", "", http.StatusBadRequest, ""},
+		{"complete", http.MethodPost, "/tasks/1/checklist/2/toggle", "", http.StatusOK, `"status":"Completed"`},
+		{"remove", http.MethodDelete, "/tasks/1/checklist/2", "", http.StatusOK, `"total":1`},
+		{"get", http.MethodGet, "/tasks/1", "", http.StatusOK, `"checklist_progress":{"completed":1,"total":1,"percent":100}`},
+		{"patch checklist", http.MethodPatch, "/tasks/1", `{"checklist": []}`, http.StatusBadRequest, "read-only"},
+		{"patch auto-complete", http.MethodPatch, "/tasks/1", `{"checklist_auto_complete": false}`, http.StatusOK, `"checklist_auto_complete":false`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// newUploadRequest builds a multipart/form-data request uploading content as the file part called name
+func newUploadRequest(t *testing.T, url string, name string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestAttachmentRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	blobs := task.NewMemoryBlobs()
+	task.SetBlobStore(blobs)
+	task.SetAttachmentQuota(64)
+	defer task.SetAttachmentQuota(0)
+	mux := newTestMux(false)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	serve(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title": "Task 1", "status": "NotStarted"}`)))
+
+	png := []byte("\x89PNG\r\n\x1a\nscreenshot")
+	rec := serve(newUploadRequest(t, "/tasks/1/attachments", `C:\shots\screen.png`, png))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var attachment task.Attachment
+	json.NewDecoder(rec.Body).Decode(&attachment)
+	if attachment.ID != 1 || attachment.Name != "screen.png" || attachment.ContentType != "image/png" || attachment.Size != int64(len(png)) {
+		t.Errorf("Unexpected attachment %+v", attachment)
+	}
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/tasks/1/attachments/1", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Fatalf("Expected the uploaded content, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("Content-Disposition") != `attachment; filename=screen.png` {
+		t.Errorf("Unexpected download headers %v", rec.Header())
+	}
+
+	// Attaching the same content again does not count towards the quota twice
+	if rec := serve(newUploadRequest(t, "/tasks/1/attachments", "copy.png", png)); rec.Code != http.StatusCreated {
+		t.Errorf("Expected a second copy to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	large := []byte(strings.Repeat("log line\n", 8))
+	if rec := serve(newUploadRequest(t, "/tasks/1/attachments", "server.log", large)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code 413 over the quota, got %d", rec.Code)
+	}
+	if ok, _ := blobs.Has(1, sha256Hex(large)); ok {
+		t.Error("Expected the content of a refused upload to be released")
+	}
+
+	tests := []struct {
+		name           string
+		req            *http.Request
+		expectedStatus int
+	}{
+		{"no file part", httptest.NewRequest(http.MethodPost, "/tasks/1/attachments", strings.NewReader("")), http.StatusBadRequest},
+		{"unknown task", newUploadRequest(t, "/tasks/9/attachments", "a.txt", []byte("a")), http.StatusNotFound},
+		{"list", httptest.NewRequest(http.MethodGet, "/tasks/1/attachments", nil), http.StatusOK},
+		{"unknown attachment", httptest.NewRequest(http.MethodGet, "/tasks/1/attachments/9", nil), http.StatusNotFound},
+		{"invalid attachment ID", httptest.NewRequest(http.MethodDelete, "/tasks/1/attachments/x", nil), http.StatusBadRequest},
+		{"remove", httptest.NewRequest(http.MethodDelete, "/tasks/1/attachments/1", nil), http.StatusNoContent},
+		{"remove again", httptest.NewRequest(http.MethodDelete, "/tasks/1/attachments/1", nil), http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if rec := serve(test.req); rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d: %s", test.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// The copy still uses the content, until its task is purged
+	if ok, _ := blobs.Has(1, attachment.SHA256); !ok {
+		t.Fatal("Expected the content to be kept while the copy uses it")
+	}
+	serve(httptest.NewRequest(http.MethodDelete, "/tasks/1", nil))
+	if ok, _ := blobs.Has(1, attachment.SHA256); !ok {
+		t.Fatal("Expected the content to be kept while the task is in the trash")
+	}
+	serve(httptest.NewRequest(http.MethodDelete, "/trash/1", nil))
+	if ok, _ := blobs.Has(1, attachment.SHA256); ok {
+		t.Error("Expected purging the task to delete the content")
+	}
+}
+
+// sha256Hex returns the hex SHA-256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTimeTrackingRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted", "tags": ["billing"]}`, http.StatusCreated, ""},
+		{"create another", http.MethodPost, "/tasks", `{"title": "Task 2", "status": "NotStarted"}`, http.StatusCreated, ""},
+		{"no timer", http.MethodGet, "/timer", "", http.StatusNotFound, "no timer"},
+		{"start", http.MethodPost, "/tasks/1/timer", "", http.StatusCreated, `"task_id":1,"id":1`},
+		{"started task", http.MethodGet, "/tasks/1", "", http.StatusOK, `"status":"Started"`},
+		{"start another", http.MethodPost, "/tasks/2/timer", `{"note": "Review"}`, http.StatusConflict, "already running"},
+		{"running timer", http.MethodGet, "/timer", "", http.StatusOK, `"stop":null`},
+		{"stop", http.MethodDelete, "/timer", "", http.StatusOK, `"task_id":1`},
+		{"log", http.MethodPost, "/tasks/2/time", `{"start": "2026-01-05T10:00:00Z", "stop": "2026-01-05T11:30:00Z", "note": "Review"}`, http.StatusCreated, `"duration_seconds":5400`},
+		{"log backwards", http.MethodPost, "/tasks/2/time", `{"start": "2026-01-05T10:00:00Z", "stop": "2026-01-05T09:00:00Z"}`, http.StatusBadRequest, "stop"},
+		{"entries", http.MethodGet, "/tasks/2/time", "", http.StatusOK, `"note":"Review"`},
+		{"report", http.MethodGet, "/reports/time?from=2026-01-05&to=2026-01-06", "", http.StatusOK, `"rows":[{"key":"2","title":"Task 2","seconds":5400}],"total_seconds":5400`},
+		{"report by tag", http.MethodGet, "/reports/time?from=2026-01-05&to=2026-01-06&group=tag", "", http.StatusOK, `{"key":"","seconds":5400}`},
+		{"csv report", http.MethodGet, "/reports/time?from=2026-01-05&to=2026-01-06&format=csv", "", http.StatusOK, "task,title,seconds,hours\n2,Task 2,5400,1.50\n"},
+		{"formula title", http.MethodPatch, "/tasks/2", `{"title": "=1+2"}`, http.StatusOK, ""},
+		{"csv report quotes formulas", http.MethodGet, "/reports/time?from=2026-01-05&to=2026-01-06&format=csv", "", http.StatusOK, "\n2,'=1+2,5400,1.50\n"},
+		{"unknown format", http.MethodGet, "/reports/time?format=xml", "", http.StatusBadRequest, "format"},
+		{"unknown group", http.MethodGet, "/reports/time?group=week", "", http.StatusBadRequest, "group"},
+		{"delete entry", http.MethodDelete, "/tasks/2/time/1", "", http.StatusNoContent, ""},
+		{"delete entry again", http.MethodDelete, "/tasks/2/time/1", "", http.StatusNotFound, ""},
+		{"patch entries", http.MethodPatch, "/tasks/2", `{"time_entries": []}`, http.StatusBadRequest, "read-only"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestEstimateRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted", "estimate": 3, "estimate_unit": "points"}`, http.StatusCreated, `"estimate":3,"estimate_unit":"points"`},
+		{"create in hours", http.MethodPost, "/tasks", `{"title": "Task 2", "status": "NotStarted", "estimate": 1.5}`, http.StatusCreated, `"estimate":1.5,"estimate_unit":"hours"`},
+		{"create negative", http.MethodPost, "/tasks", `{"title": "Task 3", "status": "NotStarted", "estimate": -2}`, http.StatusBadRequest, "estimate"},
+		{"create unknown unit", http.MethodPost, "/tasks", `{"title": "Task 3", "status": "NotStarted", "estimate": 2, "estimate_unit": "days"}`, http.StatusBadRequest, "estimate_unit"},
+		{"patch", http.MethodPatch, "/tasks/2", `{"estimate": 2, "estimate_unit": "points"}`, http.StatusOK, `"estimate":2,"estimate_unit":"points"`},
+		{"complete", http.MethodPatch, "/tasks/2", `{"status": "Completed"}`, http.StatusOK, ""},
+		{"summary", http.MethodGet, "/reports/estimates", "", http.StatusOK, `{"unit":"points","tasks":2,"estimated":5,"actual":2,"remaining":3}`},
+		{"burndown", http.MethodGet, "/reports/burndown?unit=points", "", http.StatusOK, `"remaining":3,"scope":5,"ideal":0}]`},
+		{"burndown in hours", http.MethodGet, "/reports/burndown", "", http.StatusOK, `"unit":"hours"`},
+		{"burndown unknown unit", http.MethodGet, "/reports/burndown?unit=days", "", http.StatusBadRequest, "unit"},
+		{"burndown backwards", http.MethodGet, "/reports/burndown?from=2026-01-02&to=2026-01-01", "", http.StatusBadRequest, "to"},
+		{"burndown too long", http.MethodGet, "/reports/burndown?from=2024-01-01&to=2026-01-01", "", http.StatusBadRequest, "366 days"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCommentRoutes(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		data           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create", http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted"}`, http.StatusCreated, `"comments":null`},
+		{"no comments", http.MethodGet, "/tasks/1/comments", "", http.StatusOK, "[]"},
+		{"add", http.MethodPost, "/tasks/1/comments", `{"body": " First "}`, http.StatusCreated, `"id":1,"author_id":1,"body":"First"`},
+		{"add another", http.MethodPost, "/tasks/1/comments", `{"body": "Second"}`, http.StatusCreated, `"id":2`},
+		{"add empty", http.MethodPost, "/tasks/1/comments", `{"body": "  "}`, http.StatusBadRequest, "body"},
+		{"add to unknown task", http.MethodPost, "/tasks/2/comments", `{"body": "Lost"}`, http.StatusNotFound, ""},
+		{"edit", http.MethodPut, "/tasks/1/comments/1", `{"body": "Edited"}`, http.StatusOK, `"body":"Edited"`},
+		{"edit unknown comment", http.MethodPut, "/tasks/1/comments/3", `{"body": "Edited"}`, http.StatusNotFound, "comment not found"},
+		{"delete", http.MethodDelete, "/tasks/1/comments/2", "", http.StatusNoContent, ""},
+		{"delete again", http.MethodDelete, "/tasks/1/comments/2", "", http.StatusNotFound, ""},
+		{"invalid comment ID", http.MethodDelete, "/tasks/1/comments/x", "", http.StatusBadRequest, ""},
+		{"list", http.MethodGet, "/tasks/1/comments", "", http.StatusOK, `"body":"Edited"`},
+		{"update keeps comments", http.MethodPut, "/tasks/1", `{"title": "Task 1", "status": "Started"}`, http.StatusOK, `"body":"Edited"`},
+		{"patch comments", http.MethodPatch, "/tasks/1", `{"comments": []}`, http.StatusBadRequest, "read-only"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.data)))
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected the body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHistoryRoute(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	task.SetHistoryStore(task.NewMemoryHistory())
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, false, func(handler http.Handler) http.Handler {
+		return middleware.TraceIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, addUserIDToContext(r, 1))
+		}))
+	})
+
+	steps := []struct {
+		method string
+		url    string
+		data   string
+	}{
+		{http.MethodPost, "/tasks", `{"title": "Task 1", "status": "NotStarted"}`},
+		{http.MethodPatch, "/tasks/1", `{"title": "Task 1 renamed"}`},
+		{http.MethodDelete, "/tasks/1", ""},
+	}
+	for i, step := range steps {
+		req := httptest.NewRequest(step.method, step.url, strings.NewReader(step.data))
+		req.Header.Set("X-Trace-ID", "trace-"+strconv.Itoa(i))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s failed with %d: %s", step.method, step.url, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks/1/history", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d", rec.Code)
+	}
+	var history []task.HistoryEntry
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history entries, got %+v", history)
+	}
+	for i, change := range []string{task.ChangeCreated, task.ChangeUpdated, task.ChangeDeleted} {
+		if history[i].Change != change || history[i].TraceID != "trace-"+strconv.Itoa(i) || history[i].UserID != 1 {
+			t.Errorf("Unexpected entry %d: %+v", i, history[i])
+		}
+	}
+	if renamed := history[1].Changes; len(renamed) != 1 || string(renamed[0].After) != `"Task 1 renamed"` {
+		t.Errorf("Expected the rename to be recorded, got %+v", renamed)
+	}
+
+	for url, expectedStatus := range map[string]int{"/tasks/2/history": http.StatusNotFound, "/tasks/x/history": http.StatusBadRequest} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != expectedStatus {
+			t.Errorf("Expected status code %d for %s, got %d", expectedStatus, url, rec.Code)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title": "Task 1", "status": "NotStarted"}`)))
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("Expected ETag \"1\" on create, got %q", etag)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		ifMatch        string
+		data           string
+		expectedStatus int
+		expectedETag   string
+	}{
+		{"matching revision", http.MethodPatch, `"1"`, `{"title": "Task 1 updated"}`, http.StatusOK, `"2"`},
+		{"stale revision", http.MethodPut, `"1"`, `{"title": "Lost update", "status": "Started"}`, http.StatusPreconditionFailed, `"2"`},
+		{"one of several revisions", http.MethodPut, `"5", "2"`, `{"title": "Task 1", "status": "Started"}`, http.StatusOK, `"3"`},
+		{"weak tag", http.MethodPatch, `W/"3"`, `{"status": "Completed"}`, http.StatusPreconditionFailed, `"3"`},
+		{"invalid header", http.MethodPatch, `three`, `{"status": "Completed"}`, http.StatusBadRequest, ""},
+		{"any revision", http.MethodPatch, `*`, `{"status": "Completed"}`, http.StatusOK, `"4"`},
+		{"stale delete", http.MethodDelete, `"3"`, "", http.StatusPreconditionFailed, `"4"`},
+		{"delete", http.MethodDelete, `"4"`, "", http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/tasks/1", strings.NewReader(test.data))
+			req.Header.Set("If-Match", test.ifMatch)
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if etag := rec.Header().Get("ETag"); etag != test.expectedETag {
+				t.Errorf("Expected ETag %q, got %q", test.expectedETag, etag)
+			}
+		})
+	}
+}
+
+func TestIfMatch_ReturnsCurrentTask(t *testing.T) {
+	task.InitChannel(10)
+	task.SetTasks(createEmptyTaskMap(), createEmptyTaskCountMap())
+	mux := newTestMux(false)
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title": "Task 1", "status": "NotStarted"}`)))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/tasks/1", strings.NewReader(`{"title": "Task 1 updated"}`)))
+
+	req := httptest.NewRequest(http.MethodPatch, "/tasks/1", strings.NewReader(`{"title": "Lost update"}`))
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status code %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	var body struct {
+		Current task.Task `json:"current"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if body.Current.Title != "Task 1 updated" || body.Current.Revision != 2 {
+		t.Errorf("Expected the current task in the response, got %+v", body.Current)
+	}
+}
+
 func createEmptyTaskMap() map[int][]task.Task {
 	return make(map[int][]task.Task)
 }
@@ -663,3 +1597,53 @@ func createEmptyTaskMap() map[int][]task.Task {
 func createEmptyTaskCountMap() map[int]int {
 	return make(map[int]int)
 }
+
+func TestSnapshotHandler(t *testing.T) {
+	calls := 0
+	handler := SnapshotHandler(func() error {
+		calls++
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected status %d and 1 snapshot, got %d and %d", http.StatusOK, rec.Code, calls)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil))
+	if rec.Code != http.StatusMethodNotAllowed || calls != 1 {
+		t.Errorf("Expected status %d and no snapshot, got %d and %d", http.StatusMethodNotAllowed, rec.Code, calls)
+	}
+
+	failing := SnapshotHandler(func() error { return fmt.Errorf("disk full") })
+	rec = httptest.NewRecorder()
+	failing(rec, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	guarded := middleware.AdminTokenMiddleware("secret")(handler)
+	for _, test := range []struct {
+		authorization  string
+		expectedStatus int
+		expectedCalls  int
+	}{
+		{"", http.StatusUnauthorized, 0},
+		{"Bearer wrong", http.StatusUnauthorized, 0},
+		{"secret", http.StatusUnauthorized, 0},
+		{"Bearer secret", http.StatusOK, 1},
+	} {
+		calls = 0
+		req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		rec = httptest.NewRecorder()
+		guarded.ServeHTTP(rec, req)
+		if rec.Code != test.expectedStatus || calls != test.expectedCalls {
+			t.Errorf("Expected status %d for %q, got %d with %d snapshots", test.expectedStatus, test.authorization, rec.Code, calls)
+		}
+	}
+}
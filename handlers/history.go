@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// HistoryHandler returns the changes made to the task in the path, oldest first
+// The history of deleted and purged tasks stays available.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.HistoryRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.History)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// RegisterRoutes registers the task API on mux, wrapping every handler with wrap
+// The RPC-style routes (/create, /get, /update, /delete/{id}) are only registered when legacy is set
+func RegisterRoutes(mux *http.ServeMux, legacy bool, wrap func(http.Handler) http.Handler) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, wrap(handler))
+	}
+
+	handle("GET /tasks", GetHandler)
+	handle("POST /tasks", CreateHandler)
+	handle("GET /tasks/{id}", GetTaskHandler)
+	handle("PUT /tasks/{id}", UpdateHandler)
+	handle("PATCH /tasks/{id}", PatchHandler)
+	handle("DELETE /tasks/{id}", DeleteHandler)
+	handle("POST /tasks/{id}/tags", AddTagsHandler)
+	handle("DELETE /tasks/{id}/tags/{tag}", RemoveTagHandler)
+	handle("GET /tasks/{id}/history", HistoryHandler)
+	handle("GET /tasks/{id}/attachments", GetAttachmentsHandler)
+	handle("POST /tasks/{id}/attachments", AddAttachmentHandler)
+	handle("GET /tasks/{id}/attachments/{attachmentID}", DownloadAttachmentHandler)
+	handle("DELETE /tasks/{id}/attachments/{attachmentID}", RemoveAttachmentHandler)
+	handle("POST /tasks/{id}/checklist", AddChecklistItemHandler)
+	handle("POST /tasks/{id}/checklist/{itemID}/toggle", ToggleChecklistItemHandler)
+	handle("POST /tasks/{id}/checklist/{itemID}/move", MoveChecklistItemHandler)
+	handle("DELETE /tasks/{id}/checklist/{itemID}", RemoveChecklistItemHandler)
+	handle("GET /tasks/{id}/comments", GetCommentsHandler)
+	handle("POST /tasks/{id}/comments", AddCommentHandler)
+	handle("PUT /tasks/{id}/comments/{commentID}", UpdateCommentHandler)
+	handle("DELETE /tasks/{id}/comments/{commentID}", DeleteCommentHandler)
+	handle("GET /tasks/{id}/time", GetTimeEntriesHandler)
+	handle("POST /tasks/{id}/time", LogTimeHandler)
+	handle("DELETE /tasks/{id}/time/{entryID}", DeleteTimeEntryHandler)
+	handle("POST /tasks/{id}/timer", StartTimerHandler)
+	handle("GET /tags", GetTagsHandler)
+	handle("GET /tasks/graph", GraphHandler)
+	handle("GET /tasks/next", NextHandler)
+	handle("GET /workflow", WorkflowHandler)
+	handle("GET /trash", TrashHandler)
+	handle("POST /trash/{id}/restore", RestoreHandler)
+	handle("DELETE /trash/{id}", PurgeHandler)
+	handle("GET /timer", GetTimerHandler)
+	handle("DELETE /timer", StopTimerHandler)
+	handle("GET /reports/time", TimeReportHandler)
+	handle("GET /reports/estimates", EstimatesHandler)
+	handle("GET /reports/burndown", BurndownHandler)
+
+	if legacy {
+		handle("/create", CreateHandler)
+		handle("/get", GetHandler)
+		handle("/update", UpdateHandler)
+		handle("/delete/", DeleteHandler)
+	}
+}
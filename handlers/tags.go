@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// tagsBody is the request body of AddTagsHandler
+type tagsBody struct {
+	Tags []string `json:"tags"`
+}
+
+// AddTagsHandler adds the tags in the body to a task, keeping the tags it already has
+func AddTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var body tagsBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	changeTags(w, r, task.AddTagsRequest, body.Tags)
+}
+
+// RemoveTagHandler removes the {tag} of the path from a task
+func RemoveTagHandler(w http.ResponseWriter, r *http.Request) {
+	changeTags(w, r, task.RemoveTagsRequest, []string{r.PathValue("tag")})
+}
+
+// changeTags submits a request adding or removing tags of the task in the path and writes the updated task
+func changeTags(w http.ResponseWriter, r *http.Request, action string, tags []string) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:  userID,
+		Action:  action,
+		TaskID:  taskID,
+		Tags:    tags,
+		IfMatch: ifMatch,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", etag(res.Tasks[0]))
+	writeJSON(w, http.StatusOK, res.Tasks[0])
+}
+
+// GetTagsHandler returns every tag of the user with the number of tasks carrying it
+func GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.TagsRequest,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.TagCounts)
+}
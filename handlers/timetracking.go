@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// timerBody is the optional request body of StartTimerHandler
+type timerBody struct {
+	Note string `json:"note"`
+}
+
+// GetTimeEntriesHandler returns the time entries of the task in the path, oldest first
+func GetTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: task.TimeEntriesRequest,
+		TaskID: taskID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.TimeEntries)
+}
+
+// LogTimeHandler adds the stopped time entry in the body to the task in the path and writes it
+func LogTimeHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var entry task.TimeEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:    userID,
+		Action:    task.LogTimeRequest,
+		TaskID:    taskID,
+		TimeEntry: entry,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res.TimeEntries[0])
+}
+
+// DeleteTimeEntryHandler removes the time entry in the path
+func DeleteTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	entryID, err := strconv.Atoi(r.PathValue("entryID"))
+	if err != nil {
+		http.Error(w, "Invalid time entry ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:  userID,
+		Action:  task.DeleteTimeEntryRequest,
+		TaskID:  taskID,
+		EntryID: entryID,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartTimerHandler starts timing the task in the path and writes the running timer
+// The body may hold a note for the time entry.
+func StartTimerHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := taskIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var body timerBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:    userID,
+		Action:    task.StartTimerRequest,
+		TaskID:    taskID,
+		TimeEntry: task.TimeEntry{Note: body.Note},
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res.Timer)
+}
+
+// GetTimerHandler returns the running timer of the user, or 404 when none runs
+func GetTimerHandler(w http.ResponseWriter, r *http.Request) {
+	changeTimer(w, r, task.TimerRequest)
+}
+
+// StopTimerHandler stops the running timer of the user and writes its time entry
+func StopTimerHandler(w http.ResponseWriter, r *http.Request) {
+	changeTimer(w, r, task.StopTimerRequest)
+}
+
+// changeTimer submits a request about the running timer of the user and writes the timer
+func changeTimer(w http.ResponseWriter, r *http.Request, action string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID: userID,
+		Action: action,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Timer)
+}
+
+// TimeReportHandler adds up the time spent on the tasks of the user per task, tag or day
+// It takes the from, to and group query parameters and answers in CSV with format=csv.
+func TimeReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts, err := task.ParseTimeReportOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("format: unknown format %q, expected json or csv", format), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := submit(w, r, task.Request{
+		UserID:     userID,
+		Action:     task.TimeReportRequest,
+		TimeReport: opts,
+	})
+	if !ok {
+		return
+	}
+	if res.Error != nil {
+		writeTaskError(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	if format == "csv" {
+		writeTimeReportCSV(w, res.TimeReport)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.TimeReport)
+}
+
+// writeTimeReportCSV writes a time report as CSV with a header row and a row per task, tag or day
+func writeTimeReportCSV(w http.ResponseWriter, report task.TimeReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="time-report.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{report.GroupBy, "title", "seconds", "hours"})
+	for _, row := range report.Rows {
+		writer.Write([]string{spreadsheetSafe(row.Key), spreadsheetSafe(row.Title), strconv.FormatInt(row.Seconds, 10), strconv.FormatFloat(float64(row.Seconds)/3600, 'f', 2, 64)})
+	}
+	writer.Flush()
+}
+
+// spreadsheetSafe prefixes a cell that a spreadsheet would read as a formula with a quote, so it is shown as text
+func spreadsheetSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+	"todoapp/middleware"
+	"todoapp/task"
+)
+
+// WorkflowHandler returns the statuses of the user's workflow and the transitions allowed between them
+// Workflows are configuration rather than task data, so this does not go through the task actor.
+func WorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, task.WorkflowFor(userID))
+}
@@ -14,11 +14,12 @@ import (
 
 func main() {
 	port := flag.String("port", "8080", "Port to run the backend server on")
+	legacyRoutes := flag.Bool("legacyRoutes", false, "Also serve the legacy /create, /get, /update and /delete/{id} routes")
 	flag.Parse()
 
 	logging.InitLogging(*port)
 
-	mux := createMux()
+	mux := createMux(*legacyRoutes)
 
 	wrappedMux := middleware.ChainMiddleware(mux,
 		middleware.LoadBalancerMiddleware,
@@ -39,12 +40,11 @@ func main() {
 	log.Println("Server shutting down...")
 }
 
-func createMux() *http.ServeMux {
+func createMux(legacyRoutes bool) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/create", handlers.CreateHandler)
-	mux.HandleFunc("/get", handlers.GetHandler)
-	mux.HandleFunc("/update", handlers.UpdateHandler)
-	mux.HandleFunc("/delete/", handlers.DeleteHandler)
+	handlers.RegisterRoutes(mux, legacyRoutes, func(handler http.Handler) http.Handler {
+		return handler
+	})
 
 	return mux
 }
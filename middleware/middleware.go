@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"errors"
 	"io"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -82,6 +84,22 @@ func UserIDMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AdminTokenMiddleware only lets through requests that carry token in an "Authorization: Bearer" header
+func AdminTokenMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				slog.Warn("Rejected admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Extracts the logic for determining the server address based on UserID into a separate function
 func getServerAddress(userID int) string {
 	serverIndex := userID % 3
@@ -97,6 +115,34 @@ func getServerAddress(userID int) string {
 	return serverAddr
 }
 
+// maxLoggedBody is the number of bytes of a request body LoadBalancerMiddleware logs
+const maxLoggedBody = 4 << 10
+
+// captureBody returns up to maxLoggedBody bytes of a JSON request body for logging, leaving the body readable
+// Other bodies, such as multipart uploads, are neither read nor logged.
+func captureBody(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if r.Body == nil || r.Body == http.NoBody || !strings.Contains(contentType, "json") {
+		return ""
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil {
+		slog.Error("Failed to read request body", "error", err)
+		return ""
+	}
+	if len(head) > maxLoggedBody {
+		return string(head[:maxLoggedBody]) + "..."
+	}
+	return string(head)
+}
+
+// readCloser reads from a Reader and closes a Closer, so a body that was partly read can be put back
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
 // LoadBalancerMiddleware routes requests to one of three servers based on UserID
 func LoadBalancerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -108,17 +154,7 @@ func LoadBalancerMiddleware(next http.Handler) http.Handler {
 
 		serverAddr := getServerAddress(userID)
 
-		var requestBody string
-		if r.Body != nil {
-			bodyBytes, err := io.ReadAll(r.Body)
-			if err == nil {
-				requestBody = string(bodyBytes)
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			} else {
-				slog.Error("Failed to read request body", "error", err)
-			}
-		}
-
+		requestBody := captureBody(r)
 		slog.Info("Routing request to server",
 			"ServerAddress", serverAddr,
 			"UserID", userID,
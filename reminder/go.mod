@@ -0,0 +1,7 @@
+module todoapp/reminder
+
+go 1.24.2
+
+require todoapp/task v0.0.0
+
+replace todoapp/task => ../task
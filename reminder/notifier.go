@@ -0,0 +1,186 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Reminder is a notification that a task is coming due
+// It carries only what a reminder needs, so notifiers never pass on comments, attachments or other task content.
+type Reminder struct {
+	UserID  int       `json:"user_id"`
+	TaskID  int       `json:"task_id"`
+	Title   string    `json:"title"`
+	DueDate time.Time `json:"due_date"`
+	// Lead is how long before the due date the reminder was scheduled
+	Lead time.Duration `json:"lead"`
+}
+
+// Notifier delivers reminders
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// Notifiers delivers every reminder through each of its notifiers
+type Notifiers []Notifier
+
+// Notify delivers the reminder through every notifier, even when some of them fail
+func (n Notifiers) Notify(ctx context.Context, reminder Reminder) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, reminder); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogNotifier writes reminders to the log
+type LogNotifier struct{}
+
+// Notify logs the reminder
+func (LogNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	slog.Info("Task coming due", "UserID", reminder.UserID, "TaskID", reminder.TaskID,
+		"title", reminder.Title, "due", reminder.DueDate)
+	return nil
+}
+
+// WebhookNotifier posts reminders as JSON to URL
+type WebhookNotifier struct {
+	URL string
+	// Client sends the requests; nil uses http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts the reminder and expects a 2xx response
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// smtpTimeout bounds a delivery to the SMTP server when the context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier mails reminders through the SMTP server at Addr
+type SMTPNotifier struct {
+	Addr string
+	From string
+	// To is the recipient address format, where %d is replaced by the user ID
+	To string
+	// Auth authenticates to the server; nil sends without authentication
+	Auth smtp.Auth
+}
+
+// Notify mails the reminder to the user's address
+func (n *SMTPNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	to := fmt.Sprintf(n.To, reminder.UserID)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: Reminder: %s is due %s\r\n", headerValue(reminder.Title), reminder.DueDate.Format(time.RFC1123))
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "Task %d \"%s\" is due %s.\r\n", reminder.TaskID, reminder.Title, reminder.DueDate.Format(time.RFC1123))
+
+	if err := n.send(ctx, to, []byte(msg.String())); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// send delivers msg to the recipient like smtp.SendMail, but gives up when ctx is done
+// The connection gets the deadline of ctx, or smtpTimeout without one, so a server that stops
+// answering cannot block the scheduler.
+func (n *SMTPNotifier) send(ctx context.Context, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// Canceling ctx interrupts a conversation that is waiting on the server
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Auth != nil {
+		if err := client.Auth(n.Auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// headerValue strips line breaks, so user input cannot add headers to a message
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
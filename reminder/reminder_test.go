@@ -0,0 +1,299 @@
+package reminder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"todoapp/task"
+)
+
+// recordingNotifier remembers the reminders it was asked to deliver
+type recordingNotifier struct {
+	reminders []Reminder
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	n.reminders = append(n.reminders, reminder)
+	return nil
+}
+
+func setDueTasks(now time.Time) {
+	in := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	task.SetTasks(map[int][]task.Task{
+		1: {
+			{ID: 1, Title: "Due soon", StatusID: task.NotStarted, DueDate: in(30 * time.Minute)},
+			{ID: 2, Title: "Due later", StatusID: task.NotStarted, DueDate: in(3 * time.Hour)},
+			{ID: 3, Title: "Completed", StatusID: task.Completed, DueDate: in(10 * time.Minute)},
+			{ID: 4, Title: "Overdue", StatusID: task.Started, DueDate: in(-time.Hour)},
+		},
+		2: {
+			{ID: 1, Title: "Due in two hours", StatusID: task.NotStarted, DueDate: in(2 * time.Hour)},
+		},
+	}, map[int]int{1: 4, 2: 1})
+}
+
+func TestScheduler(t *testing.T) {
+	now := time.Now()
+	setDueTasks(now)
+	stateFile := filepath.Join(t.TempDir(), "reminders.json")
+
+	notifier := &recordingNotifier{}
+	scheduler, err := NewScheduler(notifier, time.Hour, map[int]time.Duration{2: 3 * time.Hour}, stateFile)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+
+	if upcoming := scheduler.Upcoming(now); len(upcoming) != 3 {
+		t.Fatalf("Expected 3 upcoming reminders, got %+v", upcoming)
+	}
+
+	if sent := scheduler.Check(context.Background(), now); sent != 2 {
+		t.Fatalf("Expected 2 reminders to be sent, got %d", sent)
+	}
+	if notifier.reminders[0].UserID != 2 || notifier.reminders[1].TaskID != 1 {
+		t.Errorf("Expected the reminders of user 2 and task 1 of user 1, got %+v", notifier.reminders)
+	}
+	if sent := scheduler.Check(context.Background(), now); sent != 0 {
+		t.Errorf("Expected reminders to be sent once, got %d more", sent)
+	}
+
+	// After a restart the schedule is rebuilt from the tasks, without sending again
+	restarted, err := NewScheduler(notifier, time.Hour, map[int]time.Duration{2: 3 * time.Hour}, stateFile)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	if sent := restarted.Check(context.Background(), now); sent != 0 {
+		t.Errorf("Expected no reminders to be sent again after a restart, got %d", sent)
+	}
+
+	// Moving the due date schedules a new reminder
+	patch, _ := task.ParsePatch([]byte(`{"due_date": "` + now.Add(20*time.Minute).Format(time.RFC3339) + `"}`))
+	if _, err := task.PatchTask(1, 1, patch); err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if sent := restarted.Check(context.Background(), now); sent != 1 {
+		t.Errorf("Expected a reminder for the new due date, got %d", sent)
+	}
+
+	// The later task of user 1 is reminded one hour before it is due
+	if sent := restarted.Check(context.Background(), now.Add(2*time.Hour)); sent != 1 {
+		t.Errorf("Expected the reminder of the later task to be sent, got %d", sent)
+	}
+}
+
+// flakyNotifier fails until it is fixed and counts its attempts
+type flakyNotifier struct {
+	fixed    bool
+	attempts int
+}
+
+func (n *flakyNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	n.attempts++
+	if !n.fixed {
+		return errors.New("webhook down")
+	}
+	return nil
+}
+
+func TestSchedulerRetriesOnlyFailedNotifiers(t *testing.T) {
+	now := time.Now()
+	setDueTasks(now)
+	stateFile := filepath.Join(t.TempDir(), "reminders.json")
+
+	working, flaky := &recordingNotifier{}, &flakyNotifier{}
+	scheduler, err := NewScheduler(Notifiers{working, flaky}, time.Hour, map[int]time.Duration{2: 3 * time.Hour}, stateFile)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+
+	if sent := scheduler.Check(context.Background(), now); sent != 0 {
+		t.Errorf("Expected no reminder to be delivered everywhere, got %d", sent)
+	}
+	if len(working.reminders) != 2 || flaky.attempts != 2 {
+		t.Fatalf("Expected both notifiers to be tried for both reminders, got %d and %d", len(working.reminders), flaky.attempts)
+	}
+
+	// After a restart only the failed notifier is tried again
+	restarted, err := NewScheduler(Notifiers{working, flaky}, time.Hour, map[int]time.Duration{2: 3 * time.Hour}, stateFile)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	flaky.fixed = true
+	if sent := restarted.Check(context.Background(), now); sent != 2 {
+		t.Errorf("Expected both reminders to be delivered once the notifier is back, got %d", sent)
+	}
+	if len(working.reminders) != 2 || flaky.attempts != 4 {
+		t.Errorf("Expected only the failed notifier to be retried, got %d and %d", len(working.reminders), flaky.attempts)
+	}
+	if sent := restarted.Check(context.Background(), now); sent != 0 || flaky.attempts != 4 {
+		t.Errorf("Expected nothing to be sent again, got %d", sent)
+	}
+}
+
+func TestParseLeads(t *testing.T) {
+	leads, err := ParseLeads("1=30m, 2=2h")
+	if err != nil {
+		t.Fatalf("ParseLeads failed: %v", err)
+	}
+	if leads[1] != 30*time.Minute || leads[2] != 2*time.Hour {
+		t.Errorf("Unexpected lead times: %v", leads)
+	}
+
+	for _, s := range []string{"1", "x=1h", "1=soon", "1=-1h"} {
+		if _, err := ParseLeads(s); err == nil {
+			t.Errorf("Expected ParseLeads(%q) to fail", s)
+		}
+	}
+}
+
+func testReminder() Reminder {
+	return Reminder{
+		UserID:  7,
+		TaskID:  3,
+		Title:   "Pay rent\r\nBcc: someone@example.com",
+		DueDate: time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC),
+		Lead:    time.Hour,
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reminder map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&reminder); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- reminder
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{URL: server.URL}
+	if err := notifier.Notify(context.Background(), testReminder()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	reminder := <-received
+	if reminder["user_id"] != 7.0 || reminder["task_id"] != 3.0 || reminder["due_date"] != "2030-01-02T15:04:05Z" {
+		t.Errorf("Unexpected reminder posted: %+v", reminder)
+	}
+	// Only the reminder fields are posted, never the content of the task
+	if len(reminder) != 5 {
+		t.Errorf("Expected user_id, task_id, title, due_date and lead to be posted, got %+v", reminder)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	failing := &WebhookNotifier{URL: missing.URL}
+	if err := failing.Notify(context.Background(), testReminder()); err == nil {
+		t.Error("Expected an error for a non-2xx response")
+	}
+}
+
+// serveSMTP accepts a single message on listener and sends its data to messages
+func serveSMTP(listener net.Listener, messages chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			reply("354 send the message")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	messages := make(chan string, 1)
+	go serveSMTP(listener, messages)
+
+	notifier := &SMTPNotifier{Addr: listener.Addr().String(), From: "todo@localhost", To: "user%d@localhost"}
+	if err := notifier.Notify(context.Background(), testReminder()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	header, _, _ := strings.Cut(<-messages, "\r\n\r\n")
+	if !strings.Contains(header, "To: user7@localhost") {
+		t.Errorf("Expected the message to be addressed to user 7, got %q", header)
+	}
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("Expected line breaks in the title to be stripped from the headers, got %q", header)
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// The server accepts the connection but never greets
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	notifier := &SMTPNotifier{Addr: listener.Addr().String(), From: "todo@localhost", To: "user%d@localhost"}
+	start := time.Now()
+	if err := notifier.Notify(ctx, testReminder()); err == nil {
+		t.Fatal("Expected an error from a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Notify to give up at the context deadline, took %v", elapsed)
+	}
+}
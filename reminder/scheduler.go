@@ -0,0 +1,300 @@
+package reminder
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"todoapp/task"
+)
+
+// Scheduled is a reminder together with the time it fires
+type Scheduled struct {
+	Reminder
+	FireAt time.Time
+
+	// pending are the indices of the notifiers that have not delivered the reminder yet
+	pending []int
+}
+
+// sentKey identifies a reminder that was delivered
+// It includes the due date, so moving the due date schedules a new reminder.
+type sentKey struct {
+	UserID int   `json:"user_id"`
+	TaskID int   `json:"task_id"`
+	Due    int64 `json:"due"`
+}
+
+// sentRecord is a delivered reminder as saved in the state file
+type sentRecord struct {
+	sentKey
+	// Notifiers are the indices of the notifiers that delivered the reminder; none means all of them
+	Notifiers []int `json:"notifiers,omitempty"`
+}
+
+// Scheduler reminds users of their tasks a lead time before the tasks are due
+// Each check asks the task store for the open tasks due within the lead time of their user,
+// so the schedule follows task changes and is rebuilt from the loaded data after a restart.
+// When Notifier is a Notifiers, delivery is tracked per notifier, so a channel that is down is retried
+// without the others sending the reminder again.
+type Scheduler struct {
+	Notifier Notifier
+	// DefaultLead is the lead time of users without one in Leads
+	DefaultLead time.Duration
+	Leads       map[int]time.Duration
+
+	// stateFile persists the reminders that were sent, so a restart does not send them again
+	stateFile string
+
+	// checkMu keeps checks from sending the same reminder twice
+	checkMu sync.Mutex
+	// mu guards sent; it is never held while reminders are sent
+	mu sync.Mutex
+	// sent holds the indices of the notifiers that delivered a reminder, nil once all of them did
+	sent map[sentKey][]int
+}
+
+// NewScheduler creates a Scheduler and loads the reminders already sent from stateFile
+// An empty stateFile keeps them in memory only.
+func NewScheduler(notifier Notifier, defaultLead time.Duration, leads map[int]time.Duration, stateFile string) (*Scheduler, error) {
+	s := &Scheduler{
+		Notifier:    notifier,
+		DefaultLead: defaultLead,
+		Leads:       leads,
+		stateFile:   stateFile,
+		sent:        make(map[sentKey][]int),
+	}
+	if stateFile == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sent []sentRecord
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse reminder state %s: %w", stateFile, err)
+	}
+	for _, record := range sent {
+		s.sent[record.sentKey] = record.Notifiers
+	}
+	return s, nil
+}
+
+// channels returns the notifiers whose deliveries are tracked separately
+func (s *Scheduler) channels() []Notifier {
+	if notifiers, ok := s.Notifier.(Notifiers); ok {
+		return notifiers
+	}
+	return []Notifier{s.Notifier}
+}
+
+// delivered reports whether the notifier at index delivered the reminder with key
+func (s *Scheduler) delivered(key sentKey, index int) bool {
+	notifiers, ok := s.sent[key]
+	return ok && (notifiers == nil || slices.Contains(notifiers, index))
+}
+
+// lead returns the lead time of userID
+func (s *Scheduler) lead(userID int) time.Duration {
+	if lead, ok := s.Leads[userID]; ok {
+		return lead
+	}
+	return s.DefaultLead
+}
+
+// Upcoming returns the reminders not sent yet for tasks due after now, ordered by the time they fire
+// Reminders whose fire time already passed are included, since Check sends them late rather than never.
+func (s *Scheduler) Upcoming(now time.Time) []Scheduled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	farFuture := time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	return s.upcoming(now, func(int) time.Time { return farFuture })
+}
+
+// upcoming returns the reminders not sent yet for tasks due after now and no later than dueBy(userID)
+func (s *Scheduler) upcoming(now time.Time, dueBy func(userID int) time.Time) []Scheduled {
+	channels := len(s.channels())
+	var scheduled []Scheduled
+	for userID, userTasks := range task.GetDueTasks(dueBy) {
+		lead := s.lead(userID)
+		for _, t := range userTasks {
+			if !t.DueDate.After(now) {
+				continue
+			}
+			key := sentKey{UserID: userID, TaskID: t.ID, Due: t.DueDate.Unix()}
+			var pending []int
+			for index := range channels {
+				if !s.delivered(key, index) {
+					pending = append(pending, index)
+				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+			scheduled = append(scheduled, Scheduled{
+				Reminder: Reminder{UserID: userID, TaskID: t.ID, Title: t.Title, DueDate: *t.DueDate, Lead: lead},
+				FireAt:   t.DueDate.Add(-lead),
+				pending:  pending,
+			})
+		}
+	}
+	slices.SortFunc(scheduled, func(a, b Scheduled) int {
+		return cmp.Or(a.FireAt.Compare(b.FireAt), cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.TaskID, b.TaskID))
+	})
+	return scheduled
+}
+
+// Check sends the reminders that are due to fire at now and returns how many were delivered through every notifier
+// A notifier that fails to send a reminder is retried on the next check; the notifiers that succeeded are not.
+func (s *Scheduler) Check(ctx context.Context, now time.Time) int {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+
+	s.mu.Lock()
+	changed := false
+	for key := range s.sent {
+		if time.Unix(key.Due, 0).Before(now) {
+			delete(s.sent, key)
+			changed = true
+		}
+	}
+	// Only tasks due within the lead time of their user fire now
+	due := s.upcoming(now, func(userID int) time.Time { return now.Add(s.lead(userID)) })
+	s.mu.Unlock()
+
+	channels := s.channels()
+	delivered := make([][]int, len(due))
+	for i, scheduled := range due {
+		for _, index := range scheduled.pending {
+			if err := channels[index].Notify(ctx, scheduled.Reminder); err != nil {
+				slog.Error("Failed to send reminder", "UserID", scheduled.UserID, "TaskID", scheduled.TaskID,
+					"notifier", fmt.Sprintf("%T", channels[index]), "error", err)
+				continue
+			}
+			delivered[i] = append(delivered[i], index)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := 0
+	for i, scheduled := range due {
+		if len(delivered[i]) == 0 {
+			continue
+		}
+		key := sentKey{UserID: scheduled.UserID, TaskID: scheduled.TaskID, Due: scheduled.DueDate.Unix()}
+		notifiers := append(s.sent[key], delivered[i]...)
+		if len(notifiers) == len(channels) {
+			notifiers = nil
+			sent++
+		}
+		s.sent[key] = notifiers
+		changed = true
+	}
+
+	if changed {
+		if err := s.saveState(); err != nil {
+			slog.Error("Failed to save reminder state", "error", err)
+		}
+	}
+	return sent
+}
+
+// Run checks for reminders to send every interval until stop is closed
+// Closing stop also cancels the reminders being sent.
+func (s *Scheduler) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stopped, cancelStopped := context.WithCancel(context.Background())
+	defer cancelStopped()
+	go func() {
+		select {
+		case <-stop:
+			cancelStopped()
+		case <-stopped.Done():
+		}
+	}()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ctx, cancel := context.WithTimeout(stopped, interval)
+			if sent := s.Check(ctx, now); sent > 0 {
+				slog.Info("Reminders sent", "count", sent)
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// saveState writes the sent reminders to the state file through a temporary file
+func (s *Scheduler) saveState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	sent := make([]sentRecord, 0, len(s.sent))
+	for key, notifiers := range s.sent {
+		sent = append(sent, sentRecord{sentKey: key, Notifiers: notifiers})
+	}
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.stateFile), filepath.Base(s.stateFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.stateFile)
+}
+
+// ParseLeads parses per-user lead times written as "userID=duration" pairs separated by commas
+func ParseLeads(s string) (map[int]time.Duration, error) {
+	leads := make(map[int]time.Duration)
+	if s == "" {
+		return leads, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		userIDString, leadString, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid lead time %q, expected userID=duration", pair)
+		}
+		userID, err := strconv.Atoi(userIDString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID in lead time %q: %w", pair, err)
+		}
+		lead, err := time.ParseDuration(leadString)
+		if err != nil || lead < 0 {
+			return nil, fmt.Errorf("invalid duration in lead time %q", pair)
+		}
+		leads[userID] = lead
+	}
+	return leads, nil
+}
@@ -0,0 +1,297 @@
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxAttachmentNameLength is the longest attachment file name, in bytes, a task accepts
+const MaxAttachmentNameLength = 255
+
+var (
+	// ErrAttachmentNotFound is returned when a task has no attachment with the requested ID
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrInvalidAttachment is returned for an attachment without a usable name or content
+	ErrInvalidAttachment = errors.New("invalid attachment")
+	// ErrQuotaExceeded is returned when an attachment would take a user over the attachment quota
+	ErrQuotaExceeded = errors.New("attachment quota exceeded")
+	// ErrBlobNotFound is returned by a BlobStore for content it does not hold
+	ErrBlobNotFound = errors.New("blob not found")
+)
+
+// Attachment is a file attached to a task
+// The content is kept in the BlobStore under its SHA-256 digest, so a file attached twice is stored once.
+type Attachment struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// BlobStore keeps the content of attachments per user, addressed by the hex SHA-256 digest of the content
+// Implementations must be safe for concurrent use, since uploads are stored outside the actor loops.
+type BlobStore interface {
+	// Put stores the content read from r and returns its digest and size
+	Put(userID int, r io.Reader) (digest string, size int64, err error)
+	// Open returns the content with digest, or ErrBlobNotFound
+	Open(userID int, digest string) (io.ReadCloser, error)
+	// Has reports whether the content with digest is stored
+	Has(userID int, digest string) (bool, error)
+	// Delete removes the content with digest; removing missing content is not an error
+	Delete(userID int, digest string) error
+}
+
+// MemoryBlobs is a BlobStore that keeps every blob in memory
+type MemoryBlobs struct {
+	mu    sync.RWMutex
+	blobs map[int]map[string][]byte
+}
+
+// NewMemoryBlobs creates an empty MemoryBlobs
+func NewMemoryBlobs() *MemoryBlobs {
+	return &MemoryBlobs{blobs: make(map[int]map[string][]byte)}
+}
+
+// Put reads r into memory
+func (b *MemoryBlobs) Put(userID int, r io.Reader) (string, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.blobs[userID] == nil {
+		b.blobs[userID] = make(map[string][]byte)
+	}
+	b.blobs[userID][digest] = data
+	return digest, int64(len(data)), nil
+}
+
+// Open returns a reader of the blob with digest
+func (b *MemoryBlobs) Open(userID int, digest string) (io.ReadCloser, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, ok := b.blobs[userID][digest]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Has reports whether the blob with digest is in memory
+func (b *MemoryBlobs) Has(userID int, digest string) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.blobs[userID][digest]
+	return ok, nil
+}
+
+// Delete removes the blob with digest from memory
+func (b *MemoryBlobs) Delete(userID int, digest string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.blobs[userID], digest)
+	return nil
+}
+
+// blobsHolder wraps the current BlobStore, so it can be swapped atomically
+type blobsHolder struct {
+	BlobStore
+}
+
+var (
+	currentBlobs atomic.Pointer[blobsHolder]
+	// attachmentQuota is the most bytes of attachments a user may store; 0 means no limit
+	attachmentQuota atomic.Int64
+)
+
+func init() {
+	SetBlobStore(NewMemoryBlobs())
+}
+
+// SetBlobStore sets the store the content of attachments is kept in
+func SetBlobStore(b BlobStore) {
+	currentBlobs.Store(&blobsHolder{BlobStore: b})
+}
+
+// GetBlobStore returns the store the content of attachments is kept in
+func GetBlobStore() BlobStore {
+	return currentBlobs.Load().BlobStore
+}
+
+// SetAttachmentQuota sets the most bytes of attachments a user may store; 0 removes the limit
+// Content attached more than once counts once, and attachments of deleted tasks count until they are purged.
+func SetAttachmentQuota(bytes int64) {
+	attachmentQuota.Store(max(bytes, 0))
+}
+
+// AttachmentQuota returns the most bytes of attachments a user may store; 0 means no limit
+func AttachmentQuota() int64 {
+	return attachmentQuota.Load()
+}
+
+// normalizeAttachmentName reduces a file name to its last element and checks its length
+func normalizeAttachmentName(name string) (string, error) {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	switch {
+	case name == "" || name == "." || name == "/":
+		return "", &FieldError{Field: "name", Err: fmt.Errorf("%w: a file name is required", ErrInvalidAttachment)}
+	case len(name) > MaxAttachmentNameLength:
+		return "", &FieldError{Field: "name", Err: fmt.Errorf("%w: file name longer than %d bytes", ErrInvalidAttachment, MaxAttachmentNameLength)}
+	}
+	return name, nil
+}
+
+// GetAttachments returns the attachments of a task, oldest first
+func GetAttachments(userID int, taskID int) ([]Attachment, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Attachments == nil {
+		return []Attachment{}, nil
+	}
+	return task.Attachments, nil
+}
+
+// AddAttachment records an attachment whose content is already in the BlobStore and returns it
+// The content is released again when the attachment cannot be added, unless another attachment uses it.
+func AddAttachment(userID int, taskID int, attachment Attachment) (Attachment, error) {
+	added, err := addAttachment(userID, taskID, attachment)
+	if err != nil {
+		releaseBlobs(userID, []string{attachment.SHA256})
+	}
+	return added, err
+}
+
+// ReleaseBlob asks the actor loop of userID to delete content stored for an attachment whose request never
+// got an answer, unless a task is attached to it by then. Requests of a user are processed in order, so an
+// add that is still queued is applied first. It does not wait for the actor, whose queue may be full.
+func ReleaseBlob(userID int, digest string) {
+	go Send(Request{
+		UserID:     userID,
+		Action:     ReleaseBlobRequest,
+		Attachment: Attachment{SHA256: digest},
+		Response:   make(chan Response, 1),
+	})
+}
+
+func addAttachment(userID int, taskID int, attachment Attachment) (Attachment, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if attachment.Name, err = normalizeAttachmentName(attachment.Name); err != nil {
+		return Attachment{}, err
+	}
+	if ok, err := GetBlobStore().Has(userID, attachment.SHA256); err != nil {
+		return Attachment{}, err
+	} else if !ok {
+		return Attachment{}, fmt.Errorf("%w: content %s is not stored", ErrInvalidAttachment, attachment.SHA256)
+	}
+
+	if quota := AttachmentQuota(); quota > 0 {
+		usage, digests, err := attachmentUsage(userID)
+		if err != nil {
+			return Attachment{}, err
+		}
+		if !digests[attachment.SHA256] && usage+attachment.Size > quota {
+			return Attachment{}, fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, usage, quota)
+		}
+	}
+
+	now := time.Now()
+	task.MaxAttachmentID++
+	attachment.ID = task.MaxAttachmentID
+	attachment.CreatedAt = &now
+	task.Attachments = append(slices.Clone(task.Attachments), attachment)
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// RemoveAttachment removes an attachment from a task and releases its content
+func RemoveAttachment(userID int, taskID int, attachmentID int) error {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return err
+	}
+	index := slices.IndexFunc(task.Attachments, func(a Attachment) bool { return a.ID == attachmentID })
+	if index < 0 {
+		return ErrAttachmentNotFound
+	}
+
+	digest := task.Attachments[index].SHA256
+	now := time.Now()
+	task.Attachments = slices.Delete(slices.Clone(task.Attachments), index, index+1)
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return err
+	}
+	releaseBlobs(userID, []string{digest})
+	return nil
+}
+
+// attachmentUsage returns the bytes of distinct content attached to the tasks of userID,
+// including deleted tasks, and the digests of that content
+func attachmentUsage(userID int) (int64, map[string]bool, error) {
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var usage int64
+	digests := make(map[string]bool)
+	for _, task := range tasks {
+		for _, attachment := range task.Attachments {
+			if !digests[attachment.SHA256] {
+				digests[attachment.SHA256] = true
+				usage += attachment.Size
+			}
+		}
+	}
+	return usage, digests, nil
+}
+
+// releaseBlobs deletes the content with digests that no task of userID is attached to anymore
+// Failures are logged, since the content is only wasted space once nothing refers to it.
+func releaseBlobs(userID int, digests []string) {
+	if len(digests) == 0 {
+		return
+	}
+	_, used, err := attachmentUsage(userID)
+	if err != nil {
+		slog.Error("Failed to release attachment content", "UserID", userID, "error", err)
+		return
+	}
+	for _, digest := range digests {
+		if used[digest] || digest == "" {
+			continue
+		}
+		if err := GetBlobStore().Delete(userID, digest); err != nil {
+			slog.Error("Failed to delete attachment content", "UserID", userID, "digest", digest, "error", err)
+		}
+	}
+}
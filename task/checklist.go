@@ -0,0 +1,200 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxChecklistItemLength is the longest checklist item, in bytes, a task accepts
+const MaxChecklistItemLength = 500
+
+var (
+	// ErrChecklistItemNotFound is returned when a task has no checklist item with the requested ID
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
+	// ErrInvalidChecklistItem is returned when the text of a checklist item is empty or too long
+	ErrInvalidChecklistItem = errors.New("invalid checklist item")
+)
+
+// ChecklistItem is a step of a task that is too small to be a subtask
+type ChecklistItem struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// normalizeChecklistText trims the text of a checklist item and checks its length
+func normalizeChecklistText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return "", &FieldError{Field: "text", Err: fmt.Errorf("%w: items cannot be empty", ErrInvalidChecklistItem)}
+	case len(text) > MaxChecklistItemLength:
+		return "", &FieldError{Field: "text", Err: fmt.Errorf("%w: longer than %d bytes", ErrInvalidChecklistItem, MaxChecklistItemLength)}
+	}
+	return text, nil
+}
+
+// normalizeChecklist validates the checklist of a new task and numbers its items from 1
+func normalizeChecklist(task *Task) error {
+	task.MaxChecklistItemID = 0
+	if len(task.Checklist) == 0 {
+		task.Checklist = nil
+		return nil
+	}
+
+	items := make([]ChecklistItem, len(task.Checklist))
+	for i, item := range task.Checklist {
+		text, err := normalizeChecklistText(item.Text)
+		if err != nil {
+			return &FieldError{Field: "checklist", Err: err}
+		}
+		items[i] = ChecklistItem{ID: i + 1, Text: text, Done: item.Done}
+	}
+	task.Checklist = items
+	task.MaxChecklistItemID = len(items)
+	return nil
+}
+
+// withChecklistProgress returns task with the progress of its checklist filled in for a response
+func withChecklistProgress(task Task) Task {
+	task.ChecklistProgress = checklistProgress(task.Checklist)
+	return task
+}
+
+// checklistProgress counts the checked items of a checklist; an empty checklist has no progress
+func checklistProgress(items []ChecklistItem) *Progress {
+	if len(items) == 0 {
+		return nil
+	}
+	progress := &Progress{Total: len(items)}
+	for _, item := range items {
+		if item.Done {
+			progress.Completed++
+		}
+	}
+	progress.Percent = progress.Completed * 100 / progress.Total
+	return progress
+}
+
+// AddChecklistItem appends an unchecked item to the checklist of a task
+// Item IDs count up per task and are not reused after an item is removed.
+func AddChecklistItem(userID int, taskID int, text string) (Task, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if text, err = normalizeChecklistText(text); err != nil {
+		return Task{}, err
+	}
+
+	task.MaxChecklistItemID++
+	task.Checklist = append(slices.Clone(task.Checklist), ChecklistItem{ID: task.MaxChecklistItemID, Text: text})
+	return saveChecklist(userID, task)
+}
+
+// ToggleChecklistItem checks an unchecked item of the checklist of a task or unchecks a checked one
+func ToggleChecklistItem(userID int, taskID int, itemID int) (Task, error) {
+	task, index, err := getChecklistItem(userID, taskID, itemID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	task.Checklist = slices.Clone(task.Checklist)
+	task.Checklist[index].Done = !task.Checklist[index].Done
+	return saveChecklist(userID, task)
+}
+
+// MoveChecklistItem moves an item of the checklist of a task to position, counted from 0
+// Positions past the end move the item to the end.
+func MoveChecklistItem(userID int, taskID int, itemID int, position int) (Task, error) {
+	task, index, err := getChecklistItem(userID, taskID, itemID)
+	if err != nil {
+		return Task{}, err
+	}
+	if position < 0 {
+		return Task{}, &FieldError{Field: "position", Err: fmt.Errorf("%w: position cannot be negative", ErrInvalidChecklistItem)}
+	}
+
+	item := task.Checklist[index]
+	items := slices.Delete(slices.Clone(task.Checklist), index, index+1)
+	task.Checklist = slices.Insert(items, min(position, len(items)), item)
+	return saveChecklist(userID, task)
+}
+
+// RemoveChecklistItem removes an item from the checklist of a task
+func RemoveChecklistItem(userID int, taskID int, itemID int) (Task, error) {
+	task, index, err := getChecklistItem(userID, taskID, itemID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	task.Checklist = slices.Delete(slices.Clone(task.Checklist), index, index+1)
+	return saveChecklist(userID, task)
+}
+
+// getChecklistItem returns a task and the index of the checklist item with itemID
+func getChecklistItem(userID int, taskID int, itemID int) (Task, int, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Task{}, 0, err
+	}
+	index := slices.IndexFunc(task.Checklist, func(item ChecklistItem) bool { return item.ID == itemID })
+	if index < 0 {
+		return Task{}, 0, ErrChecklistItemNotFound
+	}
+	return task, index, nil
+}
+
+// saveChecklist completes a task whose checklist changed if it asked to be once every item is checked, and saves it
+func saveChecklist(userID int, task Task) (Task, error) {
+	now := time.Now()
+	previousStatus := task.StatusID
+	if err := autoComplete(userID, &task); err != nil {
+		return Task{}, err
+	}
+	task.UpdatedAt = &now
+	return completeRecurring(userID, previousStatus, task)
+}
+
+// autoComplete moves a task with ChecklistAutoComplete to the first completed state of its workflow
+// when a change to its checklist leaves every item checked. The task is left as it is when its workflow does not
+// allow the transition or an open blocker keeps it from completing; unchecking an item does not reopen it.
+func autoComplete(userID int, task *Task) error {
+	progress := checklistProgress(task.Checklist)
+	if !task.ChecklistAutoComplete || progress == nil || progress.Completed < progress.Total || task.StatusID == Completed {
+		return nil
+	}
+
+	workflow := WorkflowFor(userID)
+	for _, state := range workflow.States {
+		if state.Status() != Completed || workflow.CheckTransition(task.stateName(), state.Name) != nil {
+			continue
+		}
+		completed := *task
+		completed.setState(state)
+		var blocked *BlockedError
+		if err := checkBlocked(userID, task.StatusID, completed); errors.As(err, &blocked) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		*task = completed
+		return nil
+	}
+	return nil
+}
+
+// resetChecklist returns a copy of items with every item unchecked
+func resetChecklist(items []ChecklistItem) []ChecklistItem {
+	if items == nil {
+		return nil
+	}
+	reset := make([]ChecklistItem, len(items))
+	for i, item := range items {
+		reset[i] = ChecklistItem{ID: item.ID, Text: item.Text}
+	}
+	return reset
+}
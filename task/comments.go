@@ -0,0 +1,133 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxCommentLength is the longest comment body, in bytes, a task accepts
+const MaxCommentLength = 10000
+
+var (
+	// ErrCommentNotFound is returned when a task has no comment with the requested ID
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrInvalidComment is returned when a comment body is empty or too long
+	ErrInvalidComment = errors.New("invalid comment")
+)
+
+// Comment is a message about a task
+// Comments are stored with their task, so they are saved and restored along with it.
+type Comment struct {
+	ID        int        `json:"id"`
+	AuthorID  int        `json:"author_id"`
+	Body      string     `json:"body"`
+	CreatedAt *time.Time `json:"created_at"`
+	// UpdatedAt is nil until the comment is edited
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// normalizeComment trims the body of a comment and checks its length
+func normalizeComment(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	switch {
+	case body == "":
+		return "", &FieldError{Field: "body", Err: fmt.Errorf("%w: comments cannot be empty", ErrInvalidComment)}
+	case len(body) > MaxCommentLength:
+		return "", &FieldError{Field: "body", Err: fmt.Errorf("%w: longer than %d bytes", ErrInvalidComment, MaxCommentLength)}
+	}
+	return body, nil
+}
+
+// GetComments returns the comments of a task, oldest first
+func GetComments(userID int, taskID int) ([]Comment, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Comments == nil {
+		return []Comment{}, nil
+	}
+	return task.Comments, nil
+}
+
+// AddComment adds a comment by authorID to a task and returns it
+// Comment IDs count up per task and are not reused after a comment is deleted.
+func AddComment(userID int, taskID int, authorID int, body string) (Comment, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Comment{}, err
+	}
+	if body, err = normalizeComment(body); err != nil {
+		return Comment{}, err
+	}
+
+	now := time.Now()
+	task.MaxCommentID++
+	comment := Comment{
+		ID:        task.MaxCommentID,
+		AuthorID:  authorID,
+		Body:      body,
+		CreatedAt: &now,
+	}
+	task.Comments = append(task.Comments[:len(task.Comments):len(task.Comments)], comment)
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+// UpdateComment replaces the body of a comment and returns it
+func UpdateComment(userID int, taskID int, commentID int, body string) (Comment, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Comment{}, err
+	}
+	index := task.commentIndex(commentID)
+	if index < 0 {
+		return Comment{}, ErrCommentNotFound
+	}
+	if body, err = normalizeComment(body); err != nil {
+		return Comment{}, err
+	}
+
+	now := time.Now()
+	task.Comments = append([]Comment(nil), task.Comments...)
+	task.Comments[index].Body = body
+	task.Comments[index].UpdatedAt = &now
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return Comment{}, err
+	}
+	return task.Comments[index], nil
+}
+
+// DeleteComment removes a comment from a task
+func DeleteComment(userID int, taskID int, commentID int) error {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return err
+	}
+	index := task.commentIndex(commentID)
+	if index < 0 {
+		return ErrCommentNotFound
+	}
+
+	now := time.Now()
+	task.Comments = append(task.Comments[:index:index], task.Comments[index+1:]...)
+	task.UpdatedAt = &now
+	_, err = saveTask(userID, task)
+	return err
+}
+
+// commentIndex returns the index of the comment with commentID, or -1
+func (t Task) commentIndex(commentID int) int {
+	for i, comment := range t.Comments {
+		if comment.ID == commentID {
+			return i
+		}
+	}
+	return -1
+}
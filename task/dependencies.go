@@ -0,0 +1,225 @@
+package task
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+)
+
+var (
+	// ErrBlocked is wrapped by BlockedError
+	ErrBlocked = errors.New("task is blocked")
+	// ErrInvalidDependency is returned when a task is blocked by itself or by a task that does not exist
+	ErrInvalidDependency = errors.New("invalid dependency")
+	// ErrDependencyCycle is returned when a dependency would make a task block itself
+	ErrDependencyCycle = errors.New("dependency would create a cycle")
+)
+
+// BlockedError reports the open tasks that keep a task from moving to a status
+type BlockedError struct {
+	TaskID   int
+	Status   Status
+	Blockers []int
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%v: task %d cannot be %s while tasks %v are open", ErrBlocked, e.TaskID, e.Status, e.Blockers)
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrBlocked
+}
+
+// blockStart makes open blockers also keep a task from being started
+var blockStart atomic.Bool
+
+// SetBlockStart sets whether a blocked task can be started; it can never be completed
+func SetBlockStart(block bool) {
+	blockStart.Store(block)
+}
+
+// isBlockedStatus reports whether a task with open blockers may not move to status
+func isBlockedStatus(status Status) bool {
+	return status == Completed || (status == Started && blockStart.Load())
+}
+
+// Dependency is an edge of the dependency graph: task From blocks task To
+type Dependency struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Graph is the dependency graph of the non-deleted tasks of a user
+type Graph struct {
+	Tasks []Task       `json:"tasks"`
+	Edges []Dependency `json:"edges"`
+	// Order lists the IDs of the open tasks so that every task comes after the tasks blocking it
+	Order []int `json:"order"`
+}
+
+// normalizeBlockers sorts the blocker IDs and removes duplicates; a nil slice stays nil
+func normalizeBlockers(blockers []int) []int {
+	if blockers == nil {
+		return nil
+	}
+	normalized := slices.Clone(blockers)
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// validateBlockers checks that the blockers of task exist and do not depend on the task themselves
+// Blockers in the trash are accepted, since deleting a task keeps it in the blocked_by of its dependents;
+// like in checkBlocked they no longer block.
+func validateBlockers(userID int, task Task) error {
+	if len(task.BlockedBy) == 0 {
+		return nil
+	}
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return err
+	}
+	blockedBy := make(map[int][]int, len(tasks))
+	for _, t := range tasks {
+		blockedBy[t.ID] = t.BlockedBy
+	}
+
+	for _, blocker := range task.BlockedBy {
+		if blocker == task.ID {
+			return &FieldError{Field: "blocked_by", Err: fmt.Errorf("%w: a task cannot block itself", ErrInvalidDependency)}
+		}
+		if _, ok := blockedBy[blocker]; !ok {
+			return &FieldError{Field: "blocked_by", Err: fmt.Errorf("%w: task %d not found", ErrInvalidDependency, blocker)}
+		}
+	}
+
+	// A cycle exists if the task is among the transitive blockers of its new blockers
+	if task.ID == 0 {
+		return nil
+	}
+	seen := make(map[int]bool)
+	pending := slices.Clone(task.BlockedBy)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == task.ID {
+			return &FieldError{Field: "blocked_by", Err: ErrDependencyCycle}
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		pending = append(pending, blockedBy[id]...)
+	}
+	return nil
+}
+
+// checkBlocked returns a BlockedError if task moves to a blocked status while one of its blockers is open
+// Deleted blockers no longer block.
+func checkBlocked(userID int, previous Status, task Task) error {
+	if len(task.BlockedBy) == 0 || task.StatusID == previous || !isBlockedStatus(task.StatusID) {
+		return nil
+	}
+	var open []int
+	for _, blocker := range task.BlockedBy {
+		t, err := GetTask(userID, blocker)
+		if errors.Is(err, ErrTaskNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if t.StatusID != Completed {
+			open = append(open, blocker)
+		}
+	}
+	if len(open) > 0 {
+		return &BlockedError{TaskID: task.ID, Status: task.StatusID, Blockers: open}
+	}
+	return nil
+}
+
+// compareNext orders tasks by what to work on first: higher priority, then earlier due date, then ID
+func compareNext(a, b Task) int {
+	return cmp.Or(
+		cmp.Compare(b.PriorityID, a.PriorityID),
+		compareTimes(a.DueDate, b.DueDate),
+		cmp.Compare(a.ID, b.ID),
+	)
+}
+
+// GetDependencyGraph returns the dependency graph of the non-deleted tasks of userID
+func GetDependencyGraph(userID int) (Graph, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	graph := Graph{Tasks: tasks, Edges: []Dependency{}, Order: []int{}}
+	if graph.Tasks == nil {
+		graph.Tasks = []Task{}
+	}
+	byID := make(map[int]Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	// Kahn's algorithm over the open tasks, always taking the most pressing ready task next
+	blocking := make(map[int][]int)
+	waitingOn := make(map[int]int)
+	var ready []Task
+	for _, t := range tasks {
+		for _, blocker := range t.BlockedBy {
+			if _, ok := byID[blocker]; ok {
+				graph.Edges = append(graph.Edges, Dependency{From: blocker, To: t.ID})
+			}
+		}
+		if t.StatusID == Completed {
+			continue
+		}
+		for _, blocker := range t.BlockedBy {
+			if b, ok := byID[blocker]; ok && b.StatusID != Completed {
+				blocking[blocker] = append(blocking[blocker], t.ID)
+				waitingOn[t.ID]++
+			}
+		}
+		if waitingOn[t.ID] == 0 {
+			ready = append(ready, t)
+		}
+	}
+	for len(ready) > 0 {
+		slices.SortFunc(ready, compareNext)
+		next := ready[0]
+		ready = ready[1:]
+		graph.Order = append(graph.Order, next.ID)
+		for _, id := range blocking[next.ID] {
+			waitingOn[id]--
+			if waitingOn[id] == 0 {
+				ready = append(ready, byID[id])
+			}
+		}
+	}
+	return graph, nil
+}
+
+// GetNextTasks returns the open tasks of userID that no open task blocks, most pressing first
+func GetNextTasks(userID int) ([]Task, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[int]bool, len(tasks))
+	for _, t := range tasks {
+		open[t.ID] = t.StatusID != Completed
+	}
+
+	next := []Task{}
+	for _, t := range tasks {
+		if open[t.ID] && !slices.ContainsFunc(t.BlockedBy, func(id int) bool { return open[id] }) {
+			next = append(next, t)
+		}
+	}
+	slices.SortFunc(next, compareNext)
+	return next, nil
+}
@@ -0,0 +1,65 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Values of the due query parameter
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "week"
+)
+
+// ErrInvalidDueDate is returned when a due date is empty or before the task was created
+var ErrInvalidDueDate = errors.New("invalid due date")
+
+// ParseTime parses an RFC 3339 time or a YYYY-MM-DD date, which is taken as midnight UTC
+func ParseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	if t, err = time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("expected an RFC 3339 time or a YYYY-MM-DD date")
+}
+
+// IsOverdue reports whether the task is not completed and its due date passed before now
+func (t Task) IsOverdue(now time.Time) bool {
+	return t.DueDate != nil && t.StatusID != Completed && t.DueDate.Before(now)
+}
+
+// validateDueDate checks that a due date is set to a real time no earlier than the task's creation
+func validateDueDate(task Task) error {
+	if task.DueDate == nil {
+		return nil
+	}
+	if task.DueDate.IsZero() {
+		return &FieldError{Field: "due_date", Err: ErrInvalidDueDate}
+	}
+	if task.CreatedAt != nil && task.DueDate.Before(task.CreatedAt.Truncate(24*time.Hour)) {
+		return &FieldError{Field: "due_date", Err: fmt.Errorf("%w: it is before the task was created", ErrInvalidDueDate)}
+	}
+	return nil
+}
+
+// dueWindow returns the range of due dates selected by the due query parameter at now
+// Overdue tasks are selected by ListOptions.Overdue instead, since they also depend on the status.
+func dueWindow(due string, now time.Time) (TimeRange, error) {
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch due {
+	case DueToday:
+		end := startOfDay.AddDate(0, 0, 1)
+		return TimeRange{From: &startOfDay, To: &end}, nil
+	case DueThisWeek:
+		// Weeks start on Monday
+		start := startOfDay.AddDate(0, 0, -weekdayOffset(now.Weekday()))
+		end := start.AddDate(0, 0, 7)
+		return TimeRange{From: &start, To: &end}, nil
+	}
+	return TimeRange{}, &FieldError{Field: "due", Err: fmt.Errorf("must be %s, %s or %s", DueOverdue, DueToday, DueThisWeek)}
+}
@@ -0,0 +1,266 @@
+package task
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+)
+
+// Units of an estimate
+const (
+	Hours  = "hours"
+	Points = "points"
+)
+
+// maxBurndownDays bounds the number of days a burndown covers
+const maxBurndownDays = 366
+
+// ErrInvalidEstimate is returned for a negative estimate or an unknown estimate unit
+var ErrInvalidEstimate = errors.New("invalid estimate")
+
+// EstimateSummary compares the estimated effort of the tasks of a user with the effort spent
+// Hours are compared with the time tracked on the tasks, story points with the points of completed tasks.
+type EstimateSummary struct {
+	Unit string `json:"unit"`
+	// Tasks is the number of non-deleted tasks estimated in Unit
+	Tasks     int     `json:"tasks"`
+	Estimated float64 `json:"estimated"`
+	// Actual is the tracked hours or the points of completed tasks
+	Actual float64 `json:"actual"`
+	// Remaining is the estimate left on open tasks, never less than zero per task
+	Remaining float64 `json:"remaining"`
+}
+
+// BurndownPoint is the effort left at the end of a day
+type BurndownPoint struct {
+	Date string `json:"date"`
+	// Remaining is the estimate of the tasks that were open at the end of the day, nil for days after today
+	Remaining *float64 `json:"remaining"`
+	// Scope is the estimate of every task that existed and was not deleted at the end of the day, nil for days after today
+	Scope *float64 `json:"scope"`
+	// Ideal falls in a straight line from the first Remaining to zero on the last day
+	Ideal float64 `json:"ideal"`
+}
+
+// Burndown is the effort left on the tasks of a user day by day
+type Burndown struct {
+	Unit   string          `json:"unit"`
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Points []BurndownPoint `json:"points"`
+}
+
+// BurndownOptions selects the days and the unit of a burndown
+type BurndownOptions struct {
+	From time.Time
+	To   time.Time
+	Unit string
+}
+
+// normalizeEstimate checks the estimate of task, defaulting the unit to hours and clearing it without an estimate
+func normalizeEstimate(task *Task) error {
+	switch {
+	case task.Estimate < 0 || math.IsNaN(task.Estimate) || math.IsInf(task.Estimate, 0):
+		return &FieldError{Field: "estimate", Err: fmt.Errorf("%w: must be a positive number", ErrInvalidEstimate)}
+	case task.Estimate == 0:
+		task.EstimateUnit = ""
+	case task.EstimateUnit == "":
+		task.EstimateUnit = Hours
+	case task.EstimateUnit != Hours && task.EstimateUnit != Points:
+		return &FieldError{Field: "estimate_unit", Err: fmt.Errorf("%w: unknown unit %q, expected hours or points", ErrInvalidEstimate, task.EstimateUnit)}
+	}
+	return nil
+}
+
+// GetEstimateSummary returns the estimated, actual and remaining effort of the non-deleted tasks of userID per unit
+func GetEstimateSummary(userID int) ([]EstimateSummary, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summaries := []EstimateSummary{{Unit: Hours}, {Unit: Points}}
+	for _, task := range tasks {
+		if task.Estimate == 0 {
+			continue
+		}
+		summary := &summaries[0]
+		if task.EstimateUnit == Points {
+			summary = &summaries[1]
+		}
+		summary.Tasks++
+		summary.Estimated += task.Estimate
+
+		done := task.StatusID == Completed
+		switch {
+		case task.EstimateUnit == Hours:
+			actual := task.TimeSpent(now).Hours()
+			summary.Actual += actual
+			if !done {
+				summary.Remaining += max(task.Estimate-actual, 0)
+			}
+		case done:
+			summary.Actual += task.Estimate
+		default:
+			summary.Remaining += task.Estimate
+		}
+	}
+	return summaries, nil
+}
+
+// ParseBurndownOptions reads the from, to and unit query parameters of a burndown
+// The days default to the two weeks up to today and the unit to hours.
+func ParseBurndownOptions(query url.Values, now time.Time) (BurndownOptions, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	opts := BurndownOptions{From: today.AddDate(0, 0, -13), To: today, Unit: Hours}
+
+	for _, param := range []struct {
+		name string
+		day  *time.Time
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		day, err := time.ParseInLocation(time.DateOnly, value, now.Location())
+		if err != nil {
+			return BurndownOptions{}, &FieldError{Field: param.name, Err: errors.New("expected a YYYY-MM-DD date")}
+		}
+		*param.day = day
+	}
+	if opts.To.Before(opts.From) {
+		return BurndownOptions{}, &FieldError{Field: "to", Err: errors.New("must not be before from")}
+	}
+	if dayCount(opts.From, opts.To) > maxBurndownDays {
+		return BurndownOptions{}, &FieldError{Field: "to", Err: fmt.Errorf("a burndown covers at most %d days", maxBurndownDays)}
+	}
+
+	switch unit := query.Get("unit"); unit {
+	case "":
+	case Hours, Points:
+		opts.Unit = unit
+	default:
+		return BurndownOptions{}, &FieldError{Field: "unit", Err: fmt.Errorf("%w: unknown unit %q, expected hours or points", ErrInvalidEstimate, unit)}
+	}
+	return opts, nil
+}
+
+// dayCount returns the number of days from the day of from to the day of to, both included
+func dayCount(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours()/24)) + 1
+}
+
+// GetBurndown returns the effort left at the end of every day from opts.From to opts.To
+// The tasks are wound back from their current state through the history recorded after the first day,
+// so the work grows with the days since opts.From rather than with the whole history. Changes made before
+// history was recorded or outside the actor loops count as if they had always been there.
+func GetBurndown(userID int, opts BurndownOptions) (Burndown, error) {
+	if opts.Unit == "" {
+		opts.Unit = Hours
+	}
+	if opts.To.Before(opts.From) {
+		return Burndown{}, &FieldError{Field: "to", Err: errors.New("must not be before from")}
+	}
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return Burndown{}, err
+	}
+	entries, err := GetHistoryStore().ListUserSince(userID, opts.From.AddDate(0, 0, 1))
+	if err != nil {
+		return Burndown{}, err
+	}
+
+	states := make(map[int]*effortState, len(tasks))
+	for _, task := range tasks {
+		states[task.ID] = &effortState{StatusID: task.StatusID, Estimate: task.Estimate, EstimateUnit: task.EstimateUnit, Deleted: task.Deleted}
+	}
+
+	count := dayCount(opts.From, opts.To)
+	burndown := Burndown{
+		Unit:   opts.Unit,
+		From:   opts.From.Format(time.DateOnly),
+		To:     opts.To.Format(time.DateOnly),
+		Points: make([]BurndownPoint, count),
+	}
+	now := time.Now()
+	next := len(entries) - 1
+	for i := count - 1; i >= 0; i-- {
+		day := opts.From.AddDate(0, 0, i)
+		end := day.AddDate(0, 0, 1)
+		for ; next >= 0 && !entries[next].Time.Before(end); next-- {
+			undoChange(states, entries[next])
+		}
+
+		point := BurndownPoint{Date: day.Format(time.DateOnly)}
+		// Days still to come only have the ideal line
+		if !day.After(now) {
+			remaining, scope := effortLeft(states, opts.Unit)
+			point.Remaining, point.Scope = &remaining, &scope
+		}
+		burndown.Points[i] = point
+	}
+
+	var start float64
+	if first := burndown.Points[0].Remaining; first != nil {
+		start = *first
+	}
+	for i := range burndown.Points {
+		if count > 1 {
+			burndown.Points[i].Ideal = start * float64(count-1-i) / float64(count-1)
+		}
+	}
+	return burndown, nil
+}
+
+// effortState holds the fields of a task that a burndown depends on
+type effortState struct {
+	StatusID     Status
+	Estimate     float64
+	EstimateUnit string
+	Deleted      bool
+}
+
+// undoChange winds the fields of a task back to before a history entry
+func undoChange(states map[int]*effortState, entry HistoryEntry) {
+	if entry.Change == ChangeCreated {
+		delete(states, entry.TaskID)
+		return
+	}
+	state := states[entry.TaskID]
+	if state == nil {
+		state = &effortState{}
+		states[entry.TaskID] = state
+	}
+	for _, change := range entry.Changes {
+		switch change.Field {
+		case "status_id":
+			json.Unmarshal(change.Before, &state.StatusID)
+		case "estimate":
+			json.Unmarshal(change.Before, &state.Estimate)
+		case "estimate_unit":
+			json.Unmarshal(change.Before, &state.EstimateUnit)
+		case "deleted":
+			json.Unmarshal(change.Before, &state.Deleted)
+		}
+	}
+}
+
+// effortLeft adds up the estimates in unit of the open and of all non-deleted tasks
+func effortLeft(states map[int]*effortState, unit string) (float64, float64) {
+	var remaining, scope float64
+	for _, task := range states {
+		if task.Deleted || task.Estimate == 0 || cmp.Or(task.EstimateUnit, Hours) != unit {
+			continue
+		}
+		scope += task.Estimate
+		if task.StatusID != Completed {
+			remaining += task.Estimate
+		}
+	}
+	return remaining, scope
+}
@@ -0,0 +1,361 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of change recorded in HistoryEntry.Change
+const (
+	ChangeCreated  = "created"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+	ChangeRestored = "restored"
+	ChangePurged   = "purged"
+)
+
+// ErrHistoryNotRecorded is returned when a change was made but its history entries could not be written
+var ErrHistoryNotRecorded = errors.New("change made but its history could not be recorded")
+
+// HistoryEntry is an immutable record of a change to a task
+type HistoryEntry struct {
+	TaskID int `json:"task_id"`
+	// UserID is the user whose request made the change
+	UserID  int    `json:"user_id"`
+	TraceID string `json:"trace_id"`
+	// Action is the request that made the change; deleting a task also changes the subtasks it detaches
+	Action string `json:"action"`
+	// Change is one of the Change constants
+	Change string    `json:"change"`
+	Time   time.Time `json:"time"`
+	// Revision is the revision of the task after the change, 0 once it is purged
+	Revision int           `json:"revision"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// FieldChange is the value of a JSON field of a task before and after a change
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// HistoryStore keeps the history entries of every task
+// Implementations must be safe for concurrent use, since every actor shard records its changes.
+type HistoryStore interface {
+	// Append records entries; existing entries are never changed
+	Append(entries ...HistoryEntry) error
+	// List returns the entries of the task with taskID of userID, oldest first
+	List(userID int, taskID int) ([]HistoryEntry, error)
+	// ListUserSince returns the entries of every task of userID recorded at or after since, oldest first
+	ListUserSince(userID int, since time.Time) ([]HistoryEntry, error)
+}
+
+// MemoryHistory is a HistoryStore that keeps every entry in memory
+// The requests of a user are processed one at a time, so the entries of a user are appended oldest first.
+type MemoryHistory struct {
+	mu sync.RWMutex
+	// users holds the entries of every user in the order they were appended
+	users map[int][]HistoryEntry
+	// tasks holds the positions in users of the entries of every task of a user
+	tasks map[int]map[int][]int
+}
+
+// NewMemoryHistory creates an empty MemoryHistory
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{users: make(map[int][]HistoryEntry), tasks: make(map[int]map[int][]int)}
+}
+
+// Append records entries in memory
+func (h *MemoryHistory) Append(entries ...HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entry := range entries {
+		if h.tasks[entry.UserID] == nil {
+			h.tasks[entry.UserID] = make(map[int][]int)
+		}
+		h.tasks[entry.UserID][entry.TaskID] = append(h.tasks[entry.UserID][entry.TaskID], len(h.users[entry.UserID]))
+		h.users[entry.UserID] = append(h.users[entry.UserID], entry)
+	}
+	return nil
+}
+
+// List returns a copy of the entries of a task
+func (h *MemoryHistory) List(userID int, taskID int) ([]HistoryEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	positions := h.tasks[userID][taskID]
+	entries := make([]HistoryEntry, len(positions))
+	for i, position := range positions {
+		entries[i] = h.users[userID][position]
+	}
+	return entries, nil
+}
+
+// ListUserSince returns a copy of the entries of a user recorded at or after since
+// The entries before since are skipped by a binary search, so the cost grows with the entries returned.
+func (h *MemoryHistory) ListUserSince(userID int, since time.Time) ([]HistoryEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.users[userID]
+	first := sort.Search(len(entries), func(i int) bool { return !entries[i].Time.Before(since) })
+	return slices.Clone(entries[first:]), nil
+}
+
+// historyHolder wraps the current HistoryStore, so it can be swapped atomically
+type historyHolder struct {
+	HistoryStore
+}
+
+var currentHistory atomic.Pointer[historyHolder]
+
+func init() {
+	SetHistoryStore(NewMemoryHistory())
+}
+
+// SetHistoryStore sets the store the history of tasks is recorded in
+func SetHistoryStore(h HistoryStore) {
+	currentHistory.Store(&historyHolder{HistoryStore: h})
+}
+
+// GetHistoryStore returns the store the history of tasks is recorded in
+func GetHistoryStore() HistoryStore {
+	return currentHistory.Load().HistoryStore
+}
+
+// GetTaskHistory returns the history of a task, oldest first
+// The history of deleted and purged tasks is kept.
+func GetTaskHistory(userID int, taskID int) ([]HistoryEntry, error) {
+	entries, err := GetHistoryStore().List(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if _, err := GetStore().Get(userID, taskID); err != nil {
+			return nil, err
+		}
+		return []HistoryEntry{}, nil
+	}
+	return entries, nil
+}
+
+// changeRecorder collects the tasks a request changes, keeping the first version before and the last after it
+// A nil version means the task did not exist.
+type changeRecorder struct {
+	userID int
+	order  []int
+	before map[int]*Task
+	after  map[int]*Task
+}
+
+// recorders holds the changeRecorder of every user whose request an actor loop is processing
+// Requests of a user are processed one at a time, so a user has at most one recorder.
+var recorders sync.Map
+
+// startRecording starts collecting the changes the actor loop makes to the tasks of userID
+// Changes made outside the actor loops, for example by the CLI, are not recorded.
+func startRecording(userID int) *changeRecorder {
+	recorder := &changeRecorder{userID: userID, before: make(map[int]*Task), after: make(map[int]*Task)}
+	recorders.Store(userID, recorder)
+	return recorder
+}
+
+// recorderFor returns the recorder collecting the changes to the tasks of userID, or nil
+func recorderFor(userID int) *changeRecorder {
+	if recorder, ok := recorders.Load(userID); ok {
+		return recorder.(*changeRecorder)
+	}
+	return nil
+}
+
+// record notes that a task changed from before to after
+func (r *changeRecorder) record(taskID int, before, after *Task) {
+	if _, seen := r.before[taskID]; !seen {
+		r.order = append(r.order, taskID)
+		r.before[taskID] = before
+	}
+	r.after[taskID] = after
+}
+
+// finish stops recording and appends a history entry for every task that changed
+// The changes stay in the store when the entries cannot be appended; the error wraps ErrHistoryNotRecorded.
+func (r *changeRecorder) finish(req Request) error {
+	recorders.Delete(r.userID)
+
+	now := time.Now()
+	var entries []HistoryEntry
+	for _, taskID := range r.order {
+		before, after := r.before[taskID], r.after[taskID]
+		entry := HistoryEntry{
+			TaskID:  taskID,
+			UserID:  r.userID,
+			TraceID: req.TraceID,
+			Action:  req.Action,
+			Time:    now,
+		}
+
+		var old, current Task
+		switch {
+		case before == nil && after == nil:
+			continue
+		case before == nil:
+			entry.Change = ChangeCreated
+			current = *after
+		case after == nil:
+			entry.Change = ChangePurged
+			old = *before
+		default:
+			old, current = *before, *after
+			switch {
+			case !old.Deleted && current.Deleted:
+				entry.Change = ChangeDeleted
+			case old.Deleted && !current.Deleted:
+				entry.Change = ChangeRestored
+			default:
+				entry.Change = ChangeUpdated
+			}
+		}
+		entry.Revision = current.Revision
+		entry.Changes = diffTasks(old, current)
+		if entry.Change == ChangeUpdated && len(entry.Changes) == 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := GetHistoryStore().Append(entries...); err != nil {
+		slog.Error("Failed to record task history", "UserID", r.userID, "TraceID", req.TraceID, "error", err)
+		return fmt.Errorf("%w: %w", ErrHistoryNotRecorded, err)
+	}
+	return nil
+}
+
+// collectionFields are the fields of a task holding items with an ID
+// They are diffed item by item, so an entry grows with the items that changed rather than with the collection.
+var collectionFields = []string{"attachments", "checklist", "comments", "time_entries"}
+
+// diffTasks returns the JSON fields that differ between two versions of a task
+// The revision and update time change with every write, so they are left out.
+func diffTasks(before, after Task) []FieldChange {
+	oldFields, newFields := taskFields(before), taskFields(after)
+
+	changes := []FieldChange{}
+	for _, field := range slices.Sorted(maps.Keys(newFields)) {
+		if field == "revision" || field == "updated_at" {
+			continue
+		}
+		if slices.Contains(collectionFields, field) {
+			changes = append(changes, diffItems(field, oldFields[field], newFields[field])...)
+			continue
+		}
+		if !bytes.Equal(oldFields[field], newFields[field]) {
+			changes = append(changes, FieldChange{Field: field, Before: oldFields[field], After: newFields[field]})
+		}
+	}
+	return changes
+}
+
+// diffItems returns a change named "<field>/<ID>" for every item added, removed or changed in a collection,
+// with no before for an added and no after for a removed item, and a "<field>/order" change of the item IDs
+// when the items that were kept are in a different order.
+func diffItems(field string, before, after json.RawMessage) []FieldChange {
+	oldItems, oldOrder := collectionItems(before)
+	newItems, newOrder := collectionItems(after)
+
+	var changes []FieldChange
+	ids := slices.Collect(maps.Keys(oldItems))
+	for id := range newItems {
+		if oldItems[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		if !bytes.Equal(oldItems[id], newItems[id]) {
+			changes = append(changes, FieldChange{Field: fmt.Sprintf("%s/%d", field, id), Before: oldItems[id], After: newItems[id]})
+		}
+	}
+
+	kept := func(order []int, items map[int]json.RawMessage) []int {
+		return slices.DeleteFunc(slices.Clone(order), func(id int) bool { return items[id] == nil })
+	}
+	if !slices.Equal(kept(oldOrder, newItems), kept(newOrder, oldItems)) {
+		oldJSON, _ := json.Marshal(oldOrder)
+		newJSON, _ := json.Marshal(newOrder)
+		changes = append(changes, FieldChange{Field: field + "/order", Before: oldJSON, After: newJSON})
+	}
+	return changes
+}
+
+// collectionItems returns the JSON of every item of a collection by ID and the IDs in their order
+func collectionItems(data json.RawMessage) (map[int]json.RawMessage, []int) {
+	var raw []json.RawMessage
+	json.Unmarshal(data, &raw)
+
+	items := make(map[int]json.RawMessage, len(raw))
+	order := make([]int, 0, len(raw))
+	for _, item := range raw {
+		var key struct {
+			ID int `json:"id"`
+		}
+		json.Unmarshal(item, &key)
+		items[key.ID] = item
+		order = append(order, key.ID)
+	}
+	return items, order
+}
+
+// taskFields returns the JSON encoding of every field of task
+func taskFields(task Task) map[string]json.RawMessage {
+	data, _ := json.Marshal(task)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// createTask stores a new task and records its creation
+func createTask(userID int, task Task) (Task, error) {
+	task.ChecklistProgress = nil
+	created, err := GetStore().Create(userID, task)
+	if err != nil {
+		return Task{}, err
+	}
+	if recorder := recorderFor(userID); recorder != nil {
+		recorder.record(created.ID, nil, &created)
+	}
+	return created, nil
+}
+
+// removeTask permanently removes a task from the store and records its removal
+func removeTask(userID int, taskID int) error {
+	recorder := recorderFor(userID)
+	var before Task
+	if recorder != nil {
+		var err error
+		if before, err = GetStore().Get(userID, taskID); err != nil {
+			return err
+		}
+	}
+	if err := GetStore().Delete(userID, taskID); err != nil {
+		return err
+	}
+	if recorder != nil {
+		recorder.record(taskID, &before, nil)
+	}
+	return nil
+}
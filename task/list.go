@@ -0,0 +1,399 @@
+package task
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxListLimit caps the page size requested through ListOptions.Limit
+const MaxListLimit = 500
+
+// Sort fields accepted by ListOptions.Sort
+const (
+	SortByID        = "id"
+	SortByTitle     = "title"
+	SortByStatus    = "status"
+	SortByPriority  = "priority"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByDueDate   = "due_date"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TimeRange selects the times at or after From and strictly before To
+// A nil bound is open.
+type TimeRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// contains reports whether t is set and inside the range
+// A task without the time never matches a range that has a bound.
+func (r TimeRange) contains(t *time.Time) bool {
+	if r.From == nil && r.To == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	if r.From != nil && t.Before(*r.From) {
+		return false
+	}
+	if r.To != nil && !t.Before(*r.To) {
+		return false
+	}
+	return true
+}
+
+// ListOptions narrows down, orders and pages the tasks returned by ListTasks
+// The zero value lists every task ordered by ID.
+type ListOptions struct {
+	// Statuses keeps only tasks in one of these states of their workflow; empty keeps all
+	Statuses []string
+	// Priorities keeps only tasks with one of these priorities; empty keeps all
+	Priorities []Priority
+	// AllTags keeps only tasks carrying every one of these tags
+	AllTags []string
+	// AnyTags keeps only tasks carrying at least one of these tags
+	AnyTags []string
+	// Title keeps only tasks whose title contains it, ignoring case
+	Title   string
+	Created TimeRange
+	Updated TimeRange
+	Due     TimeRange
+	// Overdue keeps only tasks that are overdue when they are listed
+	Overdue bool
+	// Sort is one of the SortBy fields; empty sorts by ID
+	Sort string
+	Desc bool
+	// Limit is the page size, capped at MaxListLimit; 0 returns every matching task
+	Limit int
+	// Cursor is the Next token of the previous page
+	Cursor string
+	// Tree returns the tasks as trees of subtasks instead of a page, see GetTaskTree
+	Tree bool
+}
+
+// cursor is the position after which the next page starts
+// It carries the sort key of the last task of a page, so tasks created or deleted
+// between pages do not shift the following pages.
+type cursor struct {
+	Sort      string     `json:"s"`
+	Desc      bool       `json:"d,omitempty"`
+	ID        int        `json:"id"`
+	Title     string     `json:"t,omitempty"`
+	Status    string     `json:"sn,omitempty"`
+	Priority  Priority   `json:"p,omitempty"`
+	CreatedAt *time.Time `json:"c,omitempty"`
+	UpdatedAt *time.Time `json:"u,omitempty"`
+	DueDate   *time.Time `json:"due,omitempty"`
+}
+
+func encodeCursor(opts ListOptions, last Task) string {
+	data, _ := json.Marshal(cursor{
+		Sort:      opts.Sort,
+		Desc:      opts.Desc,
+		ID:        last.ID,
+		Title:     last.Title,
+		Status:    last.stateName(),
+		Priority:  last.PriorityID,
+		CreatedAt: last.CreatedAt,
+		UpdatedAt: last.UpdatedAt,
+		DueDate:   last.DueDate,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(opts ListOptions) (Task, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return Task{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Task{}, ErrInvalidCursor
+	}
+	if c.Sort != opts.Sort || c.Desc != opts.Desc {
+		return Task{}, fmt.Errorf("%w: it was issued for another sort order", ErrInvalidCursor)
+	}
+	return Task{
+		ID:           c.ID,
+		Title:        c.Title,
+		StatusString: c.Status,
+		PriorityID:   c.Priority,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		DueDate:      c.DueDate,
+	}, nil
+}
+
+// compareTimes orders missing times after present ones
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return a.Compare(*b)
+}
+
+// compareTasks orders two tasks by the sort field, breaking ties by ID
+// Statuses are ordered by their position in workflow, see Workflow.position.
+func compareTasks(a, b Task, sortField string, desc bool, workflow *Workflow) int {
+	var c int
+	switch sortField {
+	case SortByTitle:
+		c = cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case SortByStatus:
+		c = cmp.Or(
+			cmp.Compare(workflow.position(a.stateName()), workflow.position(b.stateName())),
+			cmp.Compare(a.stateName(), b.stateName()),
+		)
+	case SortByPriority:
+		c = cmp.Compare(a.PriorityID, b.PriorityID)
+	case SortByCreatedAt:
+		c = compareTimes(a.CreatedAt, b.CreatedAt)
+	case SortByUpdatedAt:
+		c = compareTimes(a.UpdatedAt, b.UpdatedAt)
+	case SortByDueDate:
+		c = compareTimes(a.DueDate, b.DueDate)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// matches reports whether a task passes the filters of opts
+func (opts ListOptions) matches(task Task) bool {
+	if len(opts.Statuses) > 0 && !slices.Contains(opts.Statuses, task.stateName()) {
+		return false
+	}
+	if len(opts.Priorities) > 0 && !slices.Contains(opts.Priorities, task.PriorityID) {
+		return false
+	}
+	for _, tag := range opts.AllTags {
+		if !task.HasTag(tag) {
+			return false
+		}
+	}
+	if len(opts.AnyTags) > 0 && !slices.ContainsFunc(opts.AnyTags, task.HasTag) {
+		return false
+	}
+	if opts.Title != "" && !strings.Contains(strings.ToLower(task.Title), strings.ToLower(opts.Title)) {
+		return false
+	}
+	if opts.Overdue && !task.IsOverdue(time.Now()) {
+		return false
+	}
+	return opts.Created.contains(task.CreatedAt) &&
+		opts.Updated.contains(task.UpdatedAt) &&
+		opts.Due.contains(task.DueDate)
+}
+
+// validateStatuses checks that the statuses are states of the workflow
+// ParseListOptions cannot check them, since workflows differ between users.
+func (opts ListOptions) validateStatuses(workflow *Workflow) error {
+	for _, status := range opts.Statuses {
+		if _, err := workflow.State(status); err != nil {
+			return &FieldError{Field: "status", Err: err}
+		}
+	}
+	return nil
+}
+
+// validate checks the sort field and limit
+func (opts ListOptions) validate() error {
+	switch opts.Sort {
+	case "", SortByID, SortByTitle, SortByStatus, SortByPriority, SortByCreatedAt, SortByUpdatedAt, SortByDueDate:
+	default:
+		return &FieldError{Field: "sort", Err: fmt.Errorf("cannot sort by %q", opts.Sort)}
+	}
+	if opts.Limit < 0 {
+		return &FieldError{Field: "limit", Err: errors.New("must not be negative")}
+	}
+	return nil
+}
+
+// ListTasks returns a page of the non-deleted tasks of userID that match opts
+// next is the cursor of the following page, or empty on the last page.
+func ListTasks(userID int, opts ListOptions) (tasks []Task, next string, err error) {
+	if err := opts.validate(); err != nil {
+		return nil, "", err
+	}
+	workflow := WorkflowFor(userID)
+	if err := opts.validateStatuses(workflow); err != nil {
+		return nil, "", err
+	}
+
+	all, err := GetTasks(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var after *Task
+	if opts.Cursor != "" {
+		last, err := decodeCursor(opts)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &last
+	}
+
+	for _, task := range all {
+		if !opts.matches(task) {
+			continue
+		}
+		if after != nil && compareTasks(task, *after, opts.Sort, opts.Desc, workflow) <= 0 {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	slices.SortStableFunc(tasks, func(a, b Task) int {
+		return compareTasks(a, b, opts.Sort, opts.Desc, workflow)
+	})
+
+	if limit := min(opts.Limit, MaxListLimit); limit > 0 && len(tasks) > limit {
+		tasks = tasks[:limit]
+		next = encodeCursor(opts, tasks[limit-1])
+	}
+	return tasks, next, nil
+}
+
+// ParseListOptions reads ListOptions from query parameters
+// status, priority, tags_all and tags_any take a comma-separated list, the *_after and *_before parameters take
+// an RFC 3339 time or a YYYY-MM-DD date, due is overdue, today or week, order is asc or desc
+// and view is flat or tree.
+func ParseListOptions(query url.Values) (ListOptions, error) {
+	opts := ListOptions{
+		Title:  query.Get("title"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	for _, statuses := range query["status"] {
+		for _, s := range strings.Split(statuses, ",") {
+			status := strings.ReplaceAll(s, " ", "")
+			if status == "" {
+				return ListOptions{}, &FieldError{Field: "status", Err: ErrInvalidStatus}
+			}
+			opts.Statuses = append(opts.Statuses, status)
+		}
+	}
+
+	for _, priorities := range query["priority"] {
+		for _, p := range strings.Split(priorities, ",") {
+			priority, err := ParsePriority(strings.TrimSpace(p))
+			if err != nil {
+				return ListOptions{}, &FieldError{Field: "priority", Err: err}
+			}
+			opts.Priorities = append(opts.Priorities, priority)
+		}
+	}
+
+	tagParams := []struct {
+		param string
+		tags  *[]string
+	}{
+		{"tags_all", &opts.AllTags},
+		{"tags_any", &opts.AnyTags},
+	}
+	for _, tp := range tagParams {
+		value := query.Get(tp.param)
+		if value == "" {
+			continue
+		}
+		normalized, err := normalizeTags(strings.Split(value, ","))
+		if err != nil {
+			return ListOptions{}, &FieldError{Field: tp.param, Err: err}
+		}
+		*tp.tags = normalized
+	}
+
+	ranges := []struct {
+		field string
+		r     *TimeRange
+	}{
+		{"created", &opts.Created},
+		{"updated", &opts.Updated},
+		{"due", &opts.Due},
+	}
+	for _, tr := range ranges {
+		var err error
+		if tr.r.From, err = parseTimeParam(query, tr.field+"_after"); err != nil {
+			return ListOptions{}, err
+		}
+		if tr.r.To, err = parseTimeParam(query, tr.field+"_before"); err != nil {
+			return ListOptions{}, err
+		}
+	}
+
+	switch due := query.Get("due"); {
+	case due == "":
+	case opts.Due.From != nil || opts.Due.To != nil:
+		return ListOptions{}, &FieldError{Field: "due", Err: errors.New("cannot be combined with due_after or due_before")}
+	case due == DueOverdue:
+		opts.Overdue = true
+	default:
+		window, err := dueWindow(due, time.Now())
+		if err != nil {
+			return ListOptions{}, err
+		}
+		opts.Due = window
+	}
+
+	switch query.Get("view") {
+	case "", "flat":
+	case "tree":
+		opts.Tree = true
+	default:
+		return ListOptions{}, &FieldError{Field: "view", Err: errors.New("must be flat or tree")}
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return ListOptions{}, &FieldError{Field: "order", Err: errors.New("must be asc or desc")}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return ListOptions{}, &FieldError{Field: "limit", Err: err}
+		}
+		opts.Limit = n
+	}
+
+	return opts, opts.validate()
+}
+
+// parseTimeParam parses the query parameter name as an RFC 3339 time or a date
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := ParseTime(value)
+	if err != nil {
+		return nil, &FieldError{Field: name, Err: err}
+	}
+	return &t, nil
+}
@@ -1,5 +1,5 @@
 // Non-actor implementation of a task manager
-// This code is a non-actor implementation of a task manager using a shared Manager and sync.Mutex.
+// This code is a non-actor implementation of a task manager using a shared Store and sync.Mutex.
 // It provides methods to create, update, delete, and retrieve tasks.
 package task
 
@@ -8,11 +8,23 @@ import (
 	"time"
 )
 
-// Non-actor implementation using a shared Manager and sync.Mutex
+// nonActorUserID is the user every NonActorManager task is stored under
+const nonActorUserID = 0
+
+// Non-actor implementation using a shared Store and sync.Mutex
+// A zero NonActorManager keeps its tasks in a new MemoryStore
 type NonActorManager struct {
-	mu        sync.Mutex
-	Tasks     []Task
-	MaxTaskID int
+	mu    sync.Mutex
+	Store Store
+}
+
+// store returns the manager's Store, creating a MemoryStore on first use
+// The caller must hold m.mu
+func (m *NonActorManager) store() Store {
+	if m.Store == nil {
+		m.Store = NewMemoryStore(nil, nil)
+	}
+	return m.Store
 }
 
 // CreateTasks creates a new task and assigns it a unique ID
@@ -20,10 +32,8 @@ func (m *NonActorManager) CreateTask(task Task) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	task.ID = m.MaxTaskID + 1
-	m.MaxTaskID++
 	task.CreatedAt = timePtr(time.Now())
-	m.Tasks = append(m.Tasks, task)
+	_, _ = m.store().Create(nonActorUserID, task)
 }
 
 // GetTasks retrieves all non-deleted tasks
@@ -31,8 +41,10 @@ func (m *NonActorManager) GetTasks() []Task {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	tasks, _ := m.store().List(nonActorUserID)
+
 	var currentTasks []Task
-	for _, task := range m.Tasks {
+	for _, task := range tasks {
 		if !task.Deleted {
 			currentTasks = append(currentTasks, task)
 		}
@@ -45,16 +57,17 @@ func (m *NonActorManager) UpdateTask(updatedTask Task) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, task := range m.Tasks {
-		if task.ID == updatedTask.ID {
-			now := time.Now()
-			m.Tasks[i].Title = updatedTask.Title
-			m.Tasks[i].Description = updatedTask.Description
-			m.Tasks[i].StatusID, _ = convertStringToStatusID(updatedTask.StatusString)
-			m.Tasks[i].UpdatedAt = &now
-			return
-		}
+	task, err := m.store().Get(nonActorUserID, updatedTask.ID)
+	if err != nil {
+		return
 	}
+
+	now := time.Now()
+	task.Title = updatedTask.Title
+	task.Description = updatedTask.Description
+	task.StatusID, _ = convertStringToStatusID(updatedTask.StatusString)
+	task.UpdatedAt = &now
+	_ = m.store().Update(nonActorUserID, task)
 }
 
 // DeleteTask marks a task as deleted
@@ -62,14 +75,15 @@ func (m *NonActorManager) DeleteTask(taskID int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, task := range m.Tasks {
-		if task.ID == taskID && !task.Deleted {
-			now := time.Now()
-			m.Tasks[i].Deleted = true
-			m.Tasks[i].DeletedAt = &now
-			return
-		}
+	task, err := m.store().Get(nonActorUserID, taskID)
+	if err != nil || task.Deleted {
+		return
 	}
+
+	now := time.Now()
+	task.Deleted = true
+	task.DeletedAt = &now
+	_ = m.store().Update(nonActorUserID, task)
 }
 
 // Helper function to create a time pointer
@@ -0,0 +1,269 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrReadOnlyField is returned when a patch sets a field that clients cannot change
+	ErrReadOnlyField = errors.New("field is read-only")
+	// ErrUnknownField is returned when a patch sets a field that tasks do not have
+	ErrUnknownField = errors.New("unknown field")
+	// ErrNullField is returned when a patch removes a field that cannot be empty
+	ErrNullField = errors.New("field cannot be null")
+)
+
+// FieldError reports which field of a request is invalid
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Patch is a partial update of a task
+// Nil fields are left unchanged.
+type Patch struct {
+	Title       *string
+	Description *string
+	Status      *string
+	Priority    *string
+	// Tags replaces the tags of the task when it is not nil
+	Tags *[]string
+	// ParentID moves the task under another task, or to the top level when it points to 0
+	ParentID *int
+	// BlockedBy replaces the blockers of the task when it is not nil
+	BlockedBy *[]int
+	DueDate   *time.Time
+	// Recurrence replaces the recurrence rule when it is not nil; an empty rule stops the task recurring
+	Recurrence *string
+	// ChecklistAutoComplete turns completing the task once its checklist is done on or off
+	ChecklistAutoComplete *bool
+	// Estimate replaces the estimate when it is not nil; 0 removes the estimate
+	Estimate *float64
+	// EstimateUnit replaces the unit of the estimate when it is not nil; empty means hours
+	EstimateUnit *string
+	// ClearDueDate removes the due date, like a null due_date in a merge patch
+	ClearDueDate bool
+}
+
+// readOnlyFields are the JSON fields of Task that only the task package sets
+var readOnlyFields = map[string]bool{
+	"id":                    true,
+	"status_id":             true,
+	"priority_id":           true,
+	"revision":              true,
+	"next_occurrence":       true,
+	"comments":              true,
+	"max_comment_id":        true,
+	"checklist":             true,
+	"checklist_progress":    true,
+	"max_checklist_item_id": true,
+	"attachments":           true,
+	"max_attachment_id":     true,
+	"time_entries":          true,
+	"max_time_entry_id":     true,
+	"created_at":            true,
+	"updated_at":            true,
+	"deleted_at":            true,
+	"deleted":               true,
+}
+
+// ParsePatch decodes a JSON Merge Patch (RFC 7396) document into a Patch
+// A null member removes the field, members that are absent are left unchanged.
+func ParsePatch(data []byte) (Patch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return Patch{}, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	var patch Patch
+	for _, field := range slices.Sorted(maps.Keys(members)) {
+		value := members[field]
+		isNull := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+
+		var err error
+		switch field {
+		case "title":
+			if isNull {
+				err = ErrNullField
+				break
+			}
+			patch.Title = new(string)
+			err = json.Unmarshal(value, patch.Title)
+		case "description":
+			patch.Description = new(string)
+			if !isNull {
+				err = json.Unmarshal(value, patch.Description)
+			}
+		case "status":
+			if isNull {
+				err = ErrNullField
+				break
+			}
+			patch.Status = new(string)
+			err = json.Unmarshal(value, patch.Status)
+		case "priority":
+			if isNull {
+				err = ErrNullField
+				break
+			}
+			patch.Priority = new(string)
+			err = json.Unmarshal(value, patch.Priority)
+		case "tags":
+			patch.Tags = new([]string)
+			if isNull {
+				*patch.Tags = []string{}
+				break
+			}
+			err = json.Unmarshal(value, patch.Tags)
+		case "parent_id":
+			patch.ParentID = new(int)
+			if !isNull {
+				err = json.Unmarshal(value, patch.ParentID)
+			}
+		case "blocked_by":
+			patch.BlockedBy = new([]int)
+			if isNull {
+				*patch.BlockedBy = []int{}
+				break
+			}
+			err = json.Unmarshal(value, patch.BlockedBy)
+		case "recurrence":
+			patch.Recurrence = new(string)
+			if !isNull {
+				err = json.Unmarshal(value, patch.Recurrence)
+			}
+		case "checklist_auto_complete":
+			patch.ChecklistAutoComplete = new(bool)
+			if !isNull {
+				err = json.Unmarshal(value, patch.ChecklistAutoComplete)
+			}
+		case "estimate":
+			patch.Estimate = new(float64)
+			if !isNull {
+				err = json.Unmarshal(value, patch.Estimate)
+			}
+		case "estimate_unit":
+			patch.EstimateUnit = new(string)
+			if !isNull {
+				err = json.Unmarshal(value, patch.EstimateUnit)
+			}
+		case "due_date":
+			if isNull {
+				patch.ClearDueDate = true
+				break
+			}
+			patch.DueDate = new(time.Time)
+			err = json.Unmarshal(value, patch.DueDate)
+		default:
+			if readOnlyFields[field] {
+				err = ErrReadOnlyField
+			} else {
+				err = ErrUnknownField
+			}
+		}
+		if err != nil {
+			return Patch{}, &FieldError{Field: field, Err: err}
+		}
+	}
+	return patch, nil
+}
+
+// PatchTask applies a partial update to an existing task and returns the updated task
+func PatchTask(userID int, taskID int, patch Patch) (Task, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	previousStatus := task.StatusID
+
+	if patch.Title != nil {
+		task.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.ChecklistAutoComplete != nil {
+		task.ChecklistAutoComplete = *patch.ChecklistAutoComplete
+	}
+	if patch.Status != nil {
+		workflow := WorkflowFor(userID)
+		state, err := workflow.State(*patch.Status)
+		if err != nil {
+			return Task{}, &FieldError{Field: "status", Err: err}
+		}
+		if err := workflow.CheckTransition(task.stateName(), state.Name); err != nil {
+			return Task{}, err
+		}
+		task.setState(state)
+	}
+	if patch.Priority != nil {
+		priorityID, err := convertStringToPriorityID(*patch.Priority)
+		if err != nil {
+			return Task{}, &FieldError{Field: "priority", Err: err}
+		}
+		task.PriorityID = priorityID
+		task.PriorityString = priorityID.String()
+	}
+	if patch.Tags != nil {
+		if task.Tags, err = normalizeTags(*patch.Tags); err != nil {
+			return Task{}, &FieldError{Field: "tags", Err: err}
+		}
+	}
+	if patch.ParentID != nil {
+		task.ParentID = *patch.ParentID
+		if err := validateParent(userID, task); err != nil {
+			return Task{}, err
+		}
+	}
+	if patch.BlockedBy != nil {
+		task.BlockedBy = normalizeBlockers(*patch.BlockedBy)
+		if err := validateBlockers(userID, task); err != nil {
+			return Task{}, err
+		}
+	}
+	if err := checkBlocked(userID, previousStatus, task); err != nil {
+		return Task{}, err
+	}
+	if patch.ClearDueDate {
+		task.DueDate = nil
+	}
+	if patch.DueDate != nil {
+		task.DueDate = patch.DueDate
+	}
+	if err := validateDueDate(task); err != nil {
+		return Task{}, err
+	}
+	if patch.Recurrence != nil {
+		task.Recurrence = *patch.Recurrence
+	}
+	if err := normalizeRecurrence(&task); err != nil {
+		return Task{}, err
+	}
+	if patch.Estimate != nil {
+		task.Estimate = *patch.Estimate
+	}
+	if patch.EstimateUnit != nil {
+		task.EstimateUnit = *patch.EstimateUnit
+	}
+	if err := normalizeEstimate(&task); err != nil {
+		return Task{}, err
+	}
+
+	now := time.Now()
+	task.UpdatedAt = &now
+	return completeRecurring(userID, previousStatus, task)
+}
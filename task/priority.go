@@ -0,0 +1,69 @@
+package task
+
+import (
+	"errors"
+	"strings"
+)
+
+// Priority represents how important a task is
+// Higher values are more important.
+type Priority int
+
+const (
+	UnknownPriority Priority = iota
+	Low
+	Medium
+	High
+	Urgent
+)
+
+// DefaultPriority is the priority of tasks created without one
+const DefaultPriority = Medium
+
+// ErrInvalidPriority is returned when a priority string is not recognized
+var ErrInvalidPriority = errors.New("invalid priority string")
+
+// String returns the name of the priority as stored in PriorityString
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "Low"
+	case Medium:
+		return "Medium"
+	case High:
+		return "High"
+	case Urgent:
+		return "Urgent"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParsePriority converts a priority string such as "High" or "P1" to its Priority
+func ParsePriority(priority string) (Priority, error) {
+	return convertStringToPriorityID(priority)
+}
+
+// convertStringToPriorityID accepts the priority names and their P0 (Urgent) to P3 (Low) aliases
+func convertStringToPriorityID(priority string) (Priority, error) {
+	switch strings.ToLower(strings.ReplaceAll(priority, " ", "")) {
+	case "low", "p3":
+		return Low, nil
+	case "medium", "p2":
+		return Medium, nil
+	case "high", "p1":
+		return High, nil
+	case "urgent", "p0":
+		return Urgent, nil
+	default:
+		return UnknownPriority, ErrInvalidPriority
+	}
+}
+
+// resolvePriority returns the priority named by priority, or fallback if it is empty
+func resolvePriority(priority string, fallback Priority) (Priority, error) {
+	if priority == "" {
+		return fallback, nil
+	}
+	return convertStringToPriorityID(priority)
+}
@@ -0,0 +1,304 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a recurring task repeats
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// ErrInvalidRecurrence is returned when a recurrence rule cannot be parsed or used
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+// untilFormat is the UTC date-time format of UNTIL in iCalendar rules
+const untilFormat = "20060102T150405Z"
+
+// maxSkippedPeriods bounds the search for a month or year that has the day of a monthly or yearly rule
+const maxSkippedPeriods = 1000
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RRule is a recurrence rule modeled on the iCalendar RRULE
+// Only FREQ, INTERVAL, BYDAY (for weekly rules), UNTIL and COUNT are supported.
+type RRule struct {
+	Freq Frequency
+	// Interval is the number of periods between occurrences, at least 1
+	Interval int
+	// ByDay are the weekdays a weekly rule falls on; empty means the weekday of the due date
+	ByDay []time.Weekday
+	// Until is the last time an occurrence may be due; nil means no end
+	Until *time.Time
+	// Count is the number of occurrences left including the current one; 0 means no limit
+	Count int
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10"
+// The "RRULE:" prefix is optional and names and values are case-insensitive.
+// UNTIL takes an iCalendar date or date-time, an RFC 3339 time or a YYYY-MM-DD date.
+func ParseRRule(rule string) (RRule, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	r := RRule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return RRule{}, fmt.Errorf("%w: expected NAME=VALUE, got %q", ErrInvalidRecurrence, part)
+		}
+		if seen[name] {
+			return RRule{}, fmt.Errorf("%w: %s is given twice", ErrInvalidRecurrence, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly, Yearly}, r.Freq) {
+				err = errors.New("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err != nil || r.Interval < 1 {
+				err = errors.New("INTERVAL must be a positive number")
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday := slices.Index(weekdayNames, day)
+				if weekday < 0 {
+					err = fmt.Errorf("unknown weekday %q in BYDAY", day)
+					break
+				}
+				r.ByDay = append(r.ByDay, time.Weekday(weekday))
+			}
+		case "UNTIL":
+			var until time.Time
+			if until, err = parseUntil(value); err != nil {
+				err = fmt.Errorf("UNTIL: %w", err)
+			}
+			r.Until = &until
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err != nil || r.Count < 1 {
+				err = errors.New("COUNT must be a positive number")
+			}
+		default:
+			err = fmt.Errorf("%s is not supported", name)
+		}
+		if err != nil {
+			return RRule{}, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return RRule{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return RRule{}, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidRecurrence)
+	case r.Until != nil && r.Count != 0:
+		return RRule{}, fmt.Errorf("%w: UNTIL and COUNT cannot be combined", ErrInvalidRecurrence)
+	}
+	// Weeks start on Monday, so Sunday is the last day of BYDAY
+	slices.SortFunc(r.ByDay, func(a, b time.Weekday) int { return weekdayOffset(a) - weekdayOffset(b) })
+	r.ByDay = slices.Compact(r.ByDay)
+	return r, nil
+}
+
+// parseUntil parses an iCalendar date or UTC date-time, or any time ParseTime accepts
+// A date is taken as the end of that day, so occurrences due on it are still included.
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilFormat, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"20060102", time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Add(24*time.Hour - time.Second), nil
+		}
+	}
+	return ParseTime(value)
+}
+
+// String formats the rule in its canonical form, which is how tasks store it
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = weekdayNames[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilFormat))
+	}
+	if r.Count != 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the occurrence following the one due at due, or false when the rule has ended
+// Monthly and yearly rules skip the months and years that do not have the day of due,
+// like iCalendar does, so a rule due on January 31 is next due on March 31.
+func (r RRule) Next(due time.Time) (time.Time, bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+	interval := max(r.Interval, 1)
+
+	var next time.Time
+	switch r.Freq {
+	case Daily:
+		next = due.AddDate(0, 0, interval)
+	case Weekly:
+		next = nextWeekly(due, interval, r.ByDay)
+	case Monthly, Yearly:
+		found := false
+		for i := 1; i <= maxSkippedPeriods && !found; i++ {
+			if r.Freq == Monthly {
+				next = due.AddDate(0, i*interval, 0)
+			} else {
+				next = due.AddDate(i*interval, 0, 0)
+			}
+			found = next.Day() == due.Day()
+		}
+		if !found {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// weekdayOffset returns the number of days from Monday to day
+func weekdayOffset(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// nextWeekly returns the next of days after due, moving on to the week interval weeks later
+// once the week of due has none left; days must be sorted from Monday to Sunday
+func nextWeekly(due time.Time, interval int, days []time.Weekday) time.Time {
+	if len(days) == 0 {
+		return due.AddDate(0, 0, 7*interval)
+	}
+	current := weekdayOffset(due.Weekday())
+	for _, day := range days {
+		if weekdayOffset(day) > current {
+			return due.AddDate(0, 0, weekdayOffset(day)-current)
+		}
+	}
+	return due.AddDate(0, 0, 7*interval-current+weekdayOffset(days[0]))
+}
+
+// normalizeRecurrence parses the recurrence of task into its canonical form
+// A recurring task needs a due date to shift.
+func normalizeRecurrence(task *Task) error {
+	if task.Recurrence == "" {
+		return nil
+	}
+	rule, err := ParseRRule(task.Recurrence)
+	if err != nil {
+		return &FieldError{Field: "recurrence", Err: err}
+	}
+	if task.DueDate == nil {
+		return &FieldError{Field: "recurrence", Err: fmt.Errorf("%w: a recurring task needs a due date", ErrInvalidRecurrence)}
+	}
+	task.Recurrence = rule.String()
+	return nil
+}
+
+// nextOccurrence returns the task to create when the recurring task is completed, or false when its rule has ended
+// The caller sets the status of the next occurrence.
+// Occurrences that passed before today while the task was open are skipped and count towards COUNT.
+func nextOccurrence(task Task, now time.Time) (Task, bool) {
+	if task.Recurrence == "" || task.DueDate == nil {
+		return Task{}, false
+	}
+	rule, err := ParseRRule(task.Recurrence)
+	if err != nil {
+		return Task{}, false
+	}
+
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	due := *task.DueDate
+	for {
+		next, ok := rule.Next(due)
+		if !ok {
+			return Task{}, false
+		}
+		due = next
+		if rule.Count > 1 {
+			rule.Count--
+		}
+		if !due.Before(startOfDay) {
+			break
+		}
+	}
+
+	return Task{
+		Title:          task.Title,
+		Description:    task.Description,
+		PriorityID:     task.PriorityID,
+		PriorityString: task.PriorityString,
+		Tags:           task.Tags,
+		ParentID:       task.ParentID,
+		CreatedAt:      &now,
+		DueDate:        &due,
+		Recurrence:     rule.String(),
+		Revision:       1,
+		// The next occurrence goes through the same steps again
+		Checklist:             resetChecklist(task.Checklist),
+		MaxChecklistItemID:    task.MaxChecklistItemID,
+		ChecklistAutoComplete: task.ChecklistAutoComplete,
+		Estimate:              task.Estimate,
+		EstimateUnit:          task.EstimateUnit,
+	}, true
+}
+
+// completeRecurring saves a task and, when it was just completed, creates its next occurrence
+// The ID of the next occurrence is recorded on the completed task, so completing it again after
+// reopening it does not create a second one. The next occurrence is removed again when the
+// completed task cannot be saved.
+func completeRecurring(userID int, previous Status, task Task) (Task, error) {
+	if previous == Completed || task.StatusID != Completed || task.NextOccurrence != 0 {
+		return saveTask(userID, task)
+	}
+	next, ok := nextOccurrence(task, time.Now())
+	if !ok {
+		return saveTask(userID, task)
+	}
+	next.setState(WorkflowFor(userID).States[0])
+	created, err := createTask(userID, next)
+	if err != nil {
+		return Task{}, err
+	}
+	task.NextOccurrence = created.ID
+	saved, err := saveTask(userID, task)
+	if err != nil {
+		// Without the completed task pointing at it, the occurrence would be created again on the next try
+		if removeErr := removeTask(userID, created.ID); removeErr != nil {
+			return Task{}, errors.Join(err, removeErr)
+		}
+		return Task{}, err
+	}
+	return saved, nil
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrRevisionMismatch is returned when a conditional request names a stale revision
+var ErrRevisionMismatch = errors.New("task revision does not match")
+
+// RevisionMismatchError reports the current version of a task a conditional request was stale for
+type RevisionMismatchError struct {
+	Current Task
+}
+
+func (e *RevisionMismatchError) Error() string {
+	return fmt.Sprintf("%v: current revision is %d", ErrRevisionMismatch, e.Current.Revision)
+}
+
+func (e *RevisionMismatchError) Unwrap() error {
+	return ErrRevisionMismatch
+}
+
+// checkPrecondition verifies that the task targeted by a conditional request is at one of the expected revisions
+func checkPrecondition(req Request) error {
+	if len(req.IfMatch) == 0 {
+		return nil
+	}
+
+	var taskID int
+	switch req.Action {
+	case UpdateRequest:
+		taskID = req.Task.ID
+	case PatchRequest, DeleteRequest, AddTagsRequest, RemoveTagsRequest,
+		AddChecklistItemRequest, ToggleChecklistItemRequest, MoveChecklistItemRequest, RemoveChecklistItemRequest:
+		taskID = req.TaskID
+	default:
+		return nil
+	}
+
+	current, err := GetTask(req.UserID, taskID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(req.IfMatch, current.Revision) {
+		return &RevisionMismatchError{Current: current}
+	}
+	return nil
+}
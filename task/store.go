@@ -0,0 +1,251 @@
+package task
+
+import (
+	"sync"
+	"time"
+)
+
+// Store is the storage backend the task package reads from and writes to.
+// Implementations must be safe for concurrent use, since the actor loop,
+// NonActorManager and the webserver may all access the same store.
+type Store interface {
+	// Create assigns the next task ID of userID to task, stores it and returns the stored task
+	Create(userID int, task Task) (Task, error)
+	// Get returns the task with taskID, including soft-deleted tasks
+	Get(userID int, taskID int) (Task, error)
+	// Update replaces the stored task that has the same ID as task
+	Update(userID int, task Task) error
+	// Delete permanently removes the task with taskID
+	Delete(userID int, taskID int) error
+	// List returns all tasks of userID, including soft-deleted tasks
+	List(userID int) ([]Task, error)
+	// Snapshot returns a copy of the tasks and max task IDs of every user
+	Snapshot() (map[int][]Task, map[int]int)
+}
+
+// DueStore is implemented by stores that track the earliest due date of the open tasks of every user,
+// so the tasks coming due are found without reading the tasks of every user
+type DueStore interface {
+	// DueBy returns the open, non-deleted tasks due no later than dueBy(userID), keyed by user
+	DueBy(dueBy func(userID int) time.Time) map[int][]Task
+}
+
+// MemoryStore is a Store that keeps every task in memory
+// Every user has its own lock, so actor shards serving different users do not contend.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[int]*userTasks
+}
+
+// userTasks holds the tasks and max task ID of a single user
+type userTasks struct {
+	mu        sync.RWMutex
+	tasks     []Task
+	maxTaskID int
+	// nextDue is the earliest due date of the open tasks, zero if none has one
+	nextDue time.Time
+}
+
+// isOpenDue reports whether task is neither deleted nor completed and has a due date
+func isOpenDue(task Task) bool {
+	return !task.Deleted && task.StatusID != Completed && task.DueDate != nil
+}
+
+// refreshDue recomputes nextDue from every task; the caller holds the write lock
+func (u *userTasks) refreshDue() {
+	u.nextDue = time.Time{}
+	for _, task := range u.tasks {
+		u.addDue(task)
+	}
+}
+
+// addDue lowers nextDue to the due date of task if it is open and due earlier
+func (u *userTasks) addDue(task Task) {
+	if isOpenDue(task) && (u.nextDue.IsZero() || task.DueDate.Before(u.nextDue)) {
+		u.nextDue = *task.DueDate
+	}
+}
+
+// replaceDue updates nextDue after old was replaced by task, or removed if task is nil
+// Only removing the task that held the earliest due date needs a scan of the other tasks.
+func (u *userTasks) replaceDue(old Task, task *Task) {
+	if isOpenDue(old) && old.DueDate.Equal(u.nextDue) {
+		u.refreshDue()
+		return
+	}
+	if task != nil {
+		u.addDue(*task)
+	}
+}
+
+// NewMemoryStore creates a MemoryStore holding the given tasks and max task IDs
+func NewMemoryStore(tasks map[int][]Task, maxTaskIDs map[int]int) *MemoryStore {
+	s := &MemoryStore{users: make(map[int]*userTasks)}
+	for userID, userTaskList := range tasks {
+		u := s.user(userID)
+		u.tasks = userTaskList
+		u.refreshDue()
+	}
+	for userID, maxTaskID := range maxTaskIDs {
+		s.user(userID).maxTaskID = maxTaskID
+	}
+	return s
+}
+
+// user returns the tasks of userID, creating an empty entry on first use
+func (s *MemoryStore) user(userID int) *userTasks {
+	s.mu.RLock()
+	u, ok := s.users[userID]
+	s.mu.RUnlock()
+	if ok {
+		return u
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok = s.users[userID]; !ok {
+		u = &userTasks{}
+		s.users[userID] = u
+	}
+	return u
+}
+
+// lookup returns the tasks of userID, or nil if the user has none
+func (s *MemoryStore) lookup(userID int) *userTasks {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.users[userID]
+}
+
+// Create adds a new task with the next ID of the user
+func (s *MemoryStore) Create(userID int, task Task) (Task, error) {
+	u := s.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.maxTaskID++
+	task.ID = u.maxTaskID
+	u.tasks = append(u.tasks, task)
+	u.addDue(task)
+	return task, nil
+}
+
+// Get retrieves a single task
+func (s *MemoryStore) Get(userID int, taskID int) (Task, error) {
+	u := s.lookup(userID)
+	if u == nil {
+		return Task{}, ErrTaskNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, task := range u.tasks {
+		if task.ID == taskID {
+			return task, nil
+		}
+	}
+	return Task{}, ErrTaskNotFound
+}
+
+// Update replaces an existing task
+func (s *MemoryStore) Update(userID int, task Task) error {
+	u := s.lookup(userID)
+	if u == nil {
+		return ErrTaskNotFound
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i, existing := range u.tasks {
+		if existing.ID == task.ID {
+			u.tasks[i] = task
+			u.replaceDue(existing, &task)
+			return nil
+		}
+	}
+	return ErrTaskNotFound
+}
+
+// Delete removes a task from the store
+func (s *MemoryStore) Delete(userID int, taskID int) error {
+	u := s.lookup(userID)
+	if u == nil {
+		return ErrTaskNotFound
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i, task := range u.tasks {
+		if task.ID == taskID {
+			u.tasks = append(u.tasks[:i:i], u.tasks[i+1:]...)
+			u.replaceDue(task, nil)
+			return nil
+		}
+	}
+	return ErrTaskNotFound
+}
+
+// List retrieves a copy of all tasks of the user
+func (s *MemoryStore) List(userID int) ([]Task, error) {
+	u := s.lookup(userID)
+	if u == nil {
+		return []Task{}, nil
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	tasks := make([]Task, len(u.tasks))
+	copy(tasks, u.tasks)
+	return tasks, nil
+}
+
+// Snapshot returns a copy of all tasks and max task IDs
+func (s *MemoryStore) Snapshot() (map[int][]Task, map[int]int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make(map[int][]Task, len(s.users))
+	maxTaskIDs := make(map[int]int, len(s.users))
+	for userID, u := range s.users {
+		u.mu.RLock()
+		if len(u.tasks) > 0 {
+			tasks[userID] = make([]Task, len(u.tasks))
+			copy(tasks[userID], u.tasks)
+		}
+		if u.maxTaskID > 0 {
+			maxTaskIDs[userID] = u.maxTaskID
+		}
+		u.mu.RUnlock()
+	}
+	return tasks, maxTaskIDs
+}
+
+// DueBy returns the open tasks due no later than dueBy(userID)
+// Only users whose earliest due date falls in their window have their tasks read.
+func (s *MemoryStore) DueBy(dueBy func(userID int) time.Time) map[int][]Task {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	due := make(map[int][]Task)
+	for userID, u := range s.users {
+		u.mu.RLock()
+		if cutoff := dueBy(userID); !u.nextDue.IsZero() && !u.nextDue.After(cutoff) {
+			due[userID] = dueTasks(u.tasks, cutoff)
+		}
+		u.mu.RUnlock()
+	}
+	return due
+}
+
+// dueTasks returns the open tasks of tasks due no later than cutoff
+func dueTasks(tasks []Task, cutoff time.Time) []Task {
+	var due []Task
+	for _, task := range tasks {
+		if isOpenDue(task) && !task.DueDate.After(cutoff) {
+			due = append(due, task)
+		}
+	}
+	return due
+}
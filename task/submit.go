@@ -0,0 +1,64 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSubmitTimeout is how long Submit waits unless SetSubmitTimeout was called
+const DefaultSubmitTimeout = 5 * time.Second
+
+var (
+	// ErrTimeout is wrapped by every error returned when Submit runs out of time
+	ErrTimeout = errors.New("request timed out")
+	// ErrQueueTimeout is returned when the shard's queue stayed full until the deadline
+	ErrQueueTimeout = fmt.Errorf("%w waiting for room in the request queue", ErrTimeout)
+	// ErrResponseTimeout is returned when the request was queued but not answered before the deadline
+	ErrResponseTimeout = fmt.Errorf("%w waiting for the response", ErrTimeout)
+	// ErrCanceled is returned when the caller's context is canceled before the response arrives
+	ErrCanceled = errors.New("request canceled")
+)
+
+var submitTimeout atomic.Int64
+
+func init() {
+	SetSubmitTimeout(DefaultSubmitTimeout)
+}
+
+// SetSubmitTimeout sets how long Submit waits for queue space and for the response together
+func SetSubmitTimeout(timeout time.Duration) {
+	submitTimeout.Store(int64(timeout))
+}
+
+// Submit queues the request on the shard owning req.UserID and waits for its response
+// It gives up when ctx is done or the submit timeout elapses, whichever comes first.
+// A request that timed out waiting for its response may still be applied later.
+func Submit(ctx context.Context, req Request) (Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(submitTimeout.Load()))
+	defer cancel()
+
+	response := make(chan Response, 1)
+	req.Response = response
+
+	if !enqueue(req, ctx.Done()) {
+		return Response{}, contextError(ctx, ErrQueueTimeout)
+	}
+
+	select {
+	case res := <-response:
+		return res, nil
+	case <-ctx.Done():
+		return Response{}, contextError(ctx, ErrResponseTimeout)
+	}
+}
+
+// contextError maps the reason ctx is done to timeoutErr or ErrCanceled
+func contextError(ctx context.Context, timeoutErr error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutErr
+	}
+	return ErrCanceled
+}
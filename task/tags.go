@@ -0,0 +1,122 @@
+package task
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxTagLength is the longest tag, in bytes, a task accepts
+const MaxTagLength = 50
+
+// ErrInvalidTag is returned when a tag is empty, too long or contains a comma
+var ErrInvalidTag = errors.New("invalid tag")
+
+// TagCount is a tag and the number of tasks of a user carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// normalizeTag trims and lowercases a tag, so "Work " and "work" are the same tag
+func normalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	switch {
+	case normalized == "":
+		return "", fmt.Errorf("%w: tags cannot be empty", ErrInvalidTag)
+	case len(normalized) > MaxTagLength:
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", ErrInvalidTag, tag, MaxTagLength)
+	case strings.Contains(normalized, ","):
+		return "", fmt.Errorf("%w: %q contains a comma", ErrInvalidTag, tag)
+	}
+	return normalized, nil
+}
+
+// normalizeTags normalizes every tag and returns them sorted without duplicates
+// A nil slice stays nil.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// HasTag reports whether the task carries tag
+func (t Task) HasTag(tag string) bool {
+	return slices.Contains(t.Tags, tag)
+}
+
+// AddTags adds tags to a task, keeping the tags it already has
+func AddTags(userID int, taskID int, tags []string) (Task, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	combined, err := normalizeTags(append(slices.Clone(task.Tags), tags...))
+	if err != nil {
+		return Task{}, &FieldError{Field: "tags", Err: err}
+	}
+	task.Tags = combined
+
+	now := time.Now()
+	task.UpdatedAt = &now
+	return saveTask(userID, task)
+}
+
+// RemoveTags removes tags from a task; tags the task does not carry are ignored
+func RemoveTags(userID int, taskID int, tags []string) (Task, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	removed, err := normalizeTags(tags)
+	if err != nil {
+		return Task{}, &FieldError{Field: "tags", Err: err}
+	}
+	task.Tags = slices.DeleteFunc(slices.Clone(task.Tags), func(tag string) bool {
+		return slices.Contains(removed, tag)
+	})
+
+	now := time.Now()
+	task.UpdatedAt = &now
+	return saveTask(userID, task)
+}
+
+// GetTagCounts returns every tag of the non-deleted tasks of userID with the number of tasks carrying it
+// The most used tags come first, ties are ordered by name.
+func GetTagCounts(userID int) ([]TagCount, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		for _, tag := range task.Tags {
+			counts[tag]++
+		}
+	}
+
+	tagCounts := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tagCounts = append(tagCounts, TagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(tagCounts, func(a, b TagCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Tag, b.Tag))
+	})
+	return tagCounts, nil
+}
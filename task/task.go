@@ -3,6 +3,8 @@ package task
 import (
 	"errors"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,10 +19,43 @@ const (
 )
 
 const (
-	GetRequest    = "get"
-	CreateRequest = "create"
-	UpdateRequest = "update"
-	DeleteRequest = "delete"
+	GetRequest                 = "get"
+	GetTaskRequest             = "get_task"
+	CreateRequest              = "create"
+	UpdateRequest              = "update"
+	PatchRequest               = "patch"
+	DeleteRequest              = "delete"
+	AddTagsRequest             = "add_tags"
+	RemoveTagsRequest          = "remove_tags"
+	TagsRequest                = "tags"
+	GraphRequest               = "graph"
+	NextRequest                = "next"
+	TrashRequest               = "trash"
+	RestoreRequest             = "restore"
+	PurgeRequest               = "purge"
+	PurgeExpiredRequest        = "purge_expired"
+	HistoryRequest             = "history"
+	CommentsRequest            = "comments"
+	AddCommentRequest          = "add_comment"
+	UpdateCommentRequest       = "update_comment"
+	DeleteCommentRequest       = "delete_comment"
+	AddChecklistItemRequest    = "add_checklist_item"
+	ToggleChecklistItemRequest = "toggle_checklist_item"
+	MoveChecklistItemRequest   = "move_checklist_item"
+	RemoveChecklistItemRequest = "remove_checklist_item"
+	AttachmentsRequest         = "attachments"
+	AddAttachmentRequest       = "add_attachment"
+	RemoveAttachmentRequest    = "remove_attachment"
+	ReleaseBlobRequest         = "release_blob"
+	TimeEntriesRequest         = "time_entries"
+	LogTimeRequest             = "log_time"
+	DeleteTimeEntryRequest     = "delete_time_entry"
+	TimerRequest               = "timer"
+	StartTimerRequest          = "start_timer"
+	StopTimerRequest           = "stop_timer"
+	TimeReportRequest          = "time_report"
+	EstimatesRequest           = "estimates"
+	BurndownRequest            = "burndown"
 )
 
 var (
@@ -30,39 +65,232 @@ var (
 	ErrInvalidStatus = errors.New("invalid status string")
 )
 
+// storeHolder wraps the current Store, so it can be swapped atomically
+type storeHolder struct {
+	Store
+}
+
 var (
-	manager = Manager{
-		Tasks:      make(map[int][]Task),
-		MaxTaskIDs: make(map[int]int)}
-	RequestsChan chan Request
+	currentStore atomic.Pointer[storeHolder]
+	// shardsMu is held for reading while a request is queued and for writing while the shards are replaced,
+	// so the channels of replaced shards are only closed once no request can be sent to them
+	shardsMu sync.RWMutex
+	// shards holds the request channel of every actor loop
+	// Requests of a user always go to shards[userID % len(shards)].
+	shards []chan Request
 )
 
+func init() {
+	SetStore(NewMemoryStore(nil, nil))
+}
+
+// GetManagerTasks returns a copy of the tasks and max task IDs held by the store
 func GetManagerTasks() (map[int][]Task, map[int]int) {
-	return manager.Tasks, manager.MaxTaskIDs
+	return GetStore().Snapshot()
+}
+
+// GetDueTasks returns the open, non-deleted tasks of every user due no later than dueBy(userID)
+func GetDueTasks(dueBy func(userID int) time.Time) map[int][]Task {
+	return DueTasks(GetStore(), dueBy)
+}
+
+// DueTasks returns the open, non-deleted tasks in store due no later than dueBy(userID)
+// It uses the due dates tracked by a DueStore and reads every task of other stores.
+func DueTasks(store Store, dueBy func(userID int) time.Time) map[int][]Task {
+	if store, ok := store.(DueStore); ok {
+		return store.DueBy(dueBy)
+	}
+	tasks, _ := store.Snapshot()
+	due := make(map[int][]Task)
+	for userID, userTasks := range tasks {
+		if userDue := dueTasks(userTasks, dueBy(userID)); len(userDue) > 0 {
+			due[userID] = userDue
+		}
+	}
+	return due
 }
 
-func processLoop() {
-	for req := range RequestsChan {
+func processLoop(requests <-chan Request) {
+	for req := range requests {
+		if err := checkPrecondition(req); err != nil {
+			req.Response <- Response{Tasks: nil, Error: err}
+			close(req.Response)
+			continue
+		}
+
+		// The next request of the user is only processed after the changes of this one are recorded
+		recorder := startRecording(req.UserID)
+		var res Response
 		switch req.Action {
 		case CreateRequest:
-			err := CreateTask(req.UserID, req.Task)
-			req.Response <- Response{Tasks: nil, Error: err}
+			created, err := CreateTask(req.UserID, req.Task)
+			res = taskResponse(created, err)
 		case GetRequest:
-			tasks := GetTasks(req.UserID)
-			req.Response <- Response{Tasks: tasks, Error: nil}
+			if req.List.Tree {
+				tree, err := GetTaskTree(req.UserID, req.List)
+				res = Response{Tree: tree, Error: err}
+				break
+			}
+			tasks, next, err := ListTasks(req.UserID, req.List)
+			res = Response{Tasks: tasks, Next: next, Error: err}
+		case GetTaskRequest:
+			task, err := GetTask(req.UserID, req.TaskID)
+			res = taskResponse(task, err)
 		case UpdateRequest:
-			err := UpdateTask(req.UserID, req.Task)
-			req.Response <- Response{Tasks: nil, Error: err}
+			update := UpdateTask
+			if req.Merge {
+				update = MergeTask
+			}
+			task, err := update(req.UserID, req.Task)
+			res = taskResponse(task, err)
+		case PatchRequest:
+			task, err := PatchTask(req.UserID, req.TaskID, req.Patch)
+			res = taskResponse(task, err)
 		case DeleteRequest:
-			err := DeleteTask(req.UserID, req.TaskID)
-			req.Response <- Response{Tasks: nil, Error: err}
+			err := DeleteTaskWithChildren(req.UserID, req.TaskID, req.ChildPolicy)
+			res = Response{Tasks: nil, Error: err}
+		case AddTagsRequest:
+			task, err := AddTags(req.UserID, req.TaskID, req.Tags)
+			res = taskResponse(task, err)
+		case RemoveTagsRequest:
+			task, err := RemoveTags(req.UserID, req.TaskID, req.Tags)
+			res = taskResponse(task, err)
+		case TagsRequest:
+			tagCounts, err := GetTagCounts(req.UserID)
+			res = Response{TagCounts: tagCounts, Error: err}
+		case GraphRequest:
+			graph, err := GetDependencyGraph(req.UserID)
+			res = Response{Graph: graph, Error: err}
+		case NextRequest:
+			tasks, err := GetNextTasks(req.UserID)
+			res = Response{Tasks: tasks, Error: err}
+		case TrashRequest:
+			tasks, err := GetDeletedTasks(req.UserID)
+			res = Response{Tasks: tasks, Error: err}
+		case RestoreRequest:
+			task, err := RestoreTask(req.UserID, req.TaskID)
+			res = taskResponse(task, err)
+		case PurgeRequest:
+			err := PurgeTask(req.UserID, req.TaskID)
+			res = Response{Tasks: nil, Error: err}
+		case PurgeExpiredRequest:
+			tasks, err := PurgeDeletedBefore(req.UserID, req.Before)
+			res = Response{Tasks: tasks, Error: err}
+		case HistoryRequest:
+			history, err := GetTaskHistory(req.UserID, req.TaskID)
+			res = Response{History: history, Error: err}
+		case AddChecklistItemRequest:
+			task, err := AddChecklistItem(req.UserID, req.TaskID, req.ItemText)
+			res = taskResponse(task, err)
+		case ToggleChecklistItemRequest:
+			task, err := ToggleChecklistItem(req.UserID, req.TaskID, req.ItemID)
+			res = taskResponse(task, err)
+		case MoveChecklistItemRequest:
+			task, err := MoveChecklistItem(req.UserID, req.TaskID, req.ItemID, req.Position)
+			res = taskResponse(task, err)
+		case RemoveChecklistItemRequest:
+			task, err := RemoveChecklistItem(req.UserID, req.TaskID, req.ItemID)
+			res = taskResponse(task, err)
+		case AttachmentsRequest:
+			attachments, err := GetAttachments(req.UserID, req.TaskID)
+			res = Response{Attachments: attachments, Error: err}
+		case AddAttachmentRequest:
+			attachment, err := AddAttachment(req.UserID, req.TaskID, req.Attachment)
+			res = Response{Attachments: []Attachment{attachment}, Error: err}
+		case ReleaseBlobRequest:
+			releaseBlobs(req.UserID, []string{req.Attachment.SHA256})
+		case RemoveAttachmentRequest:
+			err := RemoveAttachment(req.UserID, req.TaskID, req.AttachmentID)
+			res = Response{Tasks: nil, Error: err}
+		case TimeEntriesRequest:
+			entries, err := GetTimeEntries(req.UserID, req.TaskID)
+			res = Response{TimeEntries: entries, Error: err}
+		case LogTimeRequest:
+			entry, err := LogTime(req.UserID, req.TaskID, req.TimeEntry)
+			res = Response{TimeEntries: []TimeEntry{entry}, Error: err}
+		case DeleteTimeEntryRequest:
+			err := DeleteTimeEntry(req.UserID, req.TaskID, req.EntryID)
+			res = Response{Tasks: nil, Error: err}
+		case TimerRequest:
+			timer, err := GetTimer(req.UserID)
+			res = Response{Timer: timer, Error: err}
+		case StartTimerRequest:
+			timer, err := StartTimer(req.UserID, req.TaskID, req.TimeEntry.Note)
+			res = Response{Timer: timer, Error: err}
+		case StopTimerRequest:
+			timer, err := StopTimer(req.UserID)
+			res = Response{Timer: timer, Error: err}
+		case TimeReportRequest:
+			report, err := GetTimeReport(req.UserID, req.TimeReport)
+			res = Response{TimeReport: report, Error: err}
+		case EstimatesRequest:
+			summaries, err := GetEstimateSummary(req.UserID)
+			res = Response{Estimates: summaries, Error: err}
+		case BurndownRequest:
+			burndown, err := GetBurndown(req.UserID, req.Burndown)
+			res = Response{Burndown: burndown, Error: err}
+		case CommentsRequest:
+			comments, err := GetComments(req.UserID, req.TaskID)
+			res = Response{Comments: comments, Error: err}
+		case AddCommentRequest:
+			comment, err := AddComment(req.UserID, req.TaskID, req.UserID, req.Comment)
+			res = commentResponse(comment, err)
+		case UpdateCommentRequest:
+			comment, err := UpdateComment(req.UserID, req.TaskID, req.CommentID, req.Comment)
+			res = commentResponse(comment, err)
+		case DeleteCommentRequest:
+			err := DeleteComment(req.UserID, req.TaskID, req.CommentID)
+			res = Response{Tasks: nil, Error: err}
 		default:
-			req.Response <- Response{Tasks: nil, Error: errors.New("unknown action")}
+			res = Response{Tasks: nil, Error: errors.New("unknown action")}
+		}
+		// The history is written before the response, so a change the client sees is never missing from it
+		if err := recorder.finish(req); err != nil && res.Error == nil {
+			res = Response{Error: err}
+		}
+		for i := range res.Tasks {
+			res.Tasks[i] = withChecklistProgress(res.Tasks[i])
 		}
+		req.Response <- res
 		close(req.Response)
 	}
 }
 
+// String returns the name of the status as stored in StatusString
+func (s Status) String() string {
+	switch s {
+	case NotStarted:
+		return "NotStarted"
+	case Started:
+		return "Started"
+	case Completed:
+		return "Completed"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParseStatus converts a status string such as "Not Started" to its Status
+func ParseStatus(status string) (Status, error) {
+	return convertStringToStatusID(status)
+}
+
+// taskResponse builds the response of an action that results in a single task
+func taskResponse(task Task, err error) Response {
+	if err != nil {
+		return Response{Tasks: nil, Error: err}
+	}
+	return Response{Tasks: []Task{task}, Error: nil}
+}
+
+// commentResponse builds the response of an action that results in a single comment
+func commentResponse(comment Comment, err error) Response {
+	if err != nil {
+		return Response{Error: err}
+	}
+	return Response{Comments: []Comment{comment}}
+}
+
 func convertStringToStatusID(status string) (Status, error) {
 	switch strings.ReplaceAll(status, " ", "") {
 	case "NotStarted":
@@ -76,80 +304,294 @@ func convertStringToStatusID(status string) (Status, error) {
 	}
 }
 
-// InitChannel initializes the channel for task requests
+// InitChannel initializes a single actor loop for task requests
 // requestChanSize is the size of the channel for task requests
 func InitChannel(requestChanSize int) {
-	RequestsChan = make(chan Request, requestChanSize)
-	go processLoop()
+	InitShards(1, requestChanSize)
+}
+
+// InitShards starts numShards actor loops, each owning a disjoint set of users
+// requestChanSize is the size of the request channel of every shard
+// Calling it again replaces the running loops, which answer the requests already queued and stop.
+func InitShards(numShards int, requestChanSize int) {
+	if numShards < 1 {
+		numShards = 1
+	}
+
+	newShards := make([]chan Request, numShards)
+	for i := range newShards {
+		newShards[i] = make(chan Request, requestChanSize)
+		go processLoop(newShards[i])
+	}
+
+	shardsMu.Lock()
+	oldShards := shards
+	shards = newShards
+	shardsMu.Unlock()
+
+	for _, requests := range oldShards {
+		close(requests)
+	}
+}
+
+// enqueue queues req on the shard owning req.UserID, giving up when done is closed
+func enqueue(req Request, done <-chan struct{}) bool {
+	shardsMu.RLock()
+	defer shardsMu.RUnlock()
+
+	select {
+	case shardFor(req.UserID) <- req:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// shardFor returns the request channel of the shard owning userID; the caller holds shardsMu
+func shardFor(userID int) chan<- Request {
+	index := userID % len(shards)
+	if index < 0 {
+		index += len(shards)
+	}
+	return shards[index]
+}
+
+// Send queues the request on the shard owning req.UserID, waiting for room if the queue is full
+func Send(req Request) {
+	enqueue(req, nil)
+}
+
+// SetStore sets the store every task operation runs against
+func SetStore(s Store) {
+	currentStore.Store(&storeHolder{Store: s})
+}
+
+// GetStore returns the store every task operation runs against
+func GetStore() Store {
+	return currentStore.Load().Store
 }
 
-// SetTasks sets the tasks and max task IDs for the manager
+// SetTasks replaces the store with a MemoryStore holding the given tasks and max task IDs
 func SetTasks(tasks map[int][]Task, maxTaskIDs map[int]int) {
-	manager.Tasks = tasks
-	manager.MaxTaskIDs = maxTaskIDs
+	SetStore(NewMemoryStore(tasks, maxTaskIDs))
 }
 
-// CreateTask adds a new task to the list of tasks
-func CreateTask(userID int, task Task) error {
+// CreateTask adds a new task to the list of tasks and returns it with its assigned ID
+func CreateTask(userID int, task Task) (Task, error) {
 	now := time.Now()
 
-	statusID, err := convertStringToStatusID(task.StatusString)
+	state, err := WorkflowFor(userID).State(task.StatusString)
 	if err != nil {
-		return ErrInvalidStatus
+		return Task{}, err
+	}
+	priorityID, err := resolvePriority(task.PriorityString, DefaultPriority)
+	if err != nil {
+		return Task{}, ErrInvalidPriority
 	}
 
-	manager.MaxTaskIDs[userID]++
-	task.ID = manager.MaxTaskIDs[userID]
 	task.CreatedAt = &now
-	task.StatusID = statusID
+	task.setState(state)
+	task.PriorityID = priorityID
+	task.PriorityString = priorityID.String()
+	task.Revision = 1
+	if task.Tags, err = normalizeTags(task.Tags); err != nil {
+		return Task{}, &FieldError{Field: "tags", Err: err}
+	}
+	if err := validateParent(userID, task); err != nil {
+		return Task{}, err
+	}
+	task.BlockedBy = normalizeBlockers(task.BlockedBy)
+	if err := validateBlockers(userID, task); err != nil {
+		return Task{}, err
+	}
+	if err := checkBlocked(userID, Unknown, task); err != nil {
+		return Task{}, err
+	}
+	if err := validateDueDate(task); err != nil {
+		return Task{}, err
+	}
+	if err := normalizeRecurrence(&task); err != nil {
+		return Task{}, err
+	}
+	task.NextOccurrence = 0
+	task.Comments = nil
+	task.MaxCommentID = 0
+	task.Attachments = nil
+	task.MaxAttachmentID = 0
+	task.TimeEntries = nil
+	task.MaxTimeEntryID = 0
+	if err := normalizeChecklist(&task); err != nil {
+		return Task{}, err
+	}
+	if err := normalizeEstimate(&task); err != nil {
+		return Task{}, err
+	}
 
-	manager.Tasks[userID] = append(manager.Tasks[userID], task)
-	return nil
+	return createTask(userID, task)
+}
+
+// GetTask retrieves a single non-deleted task
+func GetTask(userID int, taskID int) (Task, error) {
+	task, err := GetStore().Get(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if task.Deleted {
+		return Task{}, ErrTaskNotFound
+	}
+	return task, nil
 }
 
 // GetTasks retrieves all non-deleted tasks
-func GetTasks(userID int) []Task {
+func GetTasks(userID int) ([]Task, error) {
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	var currentTasks []Task
-	for _, task := range manager.Tasks[userID] {
+	for _, task := range tasks {
 		if !task.Deleted {
 			currentTasks = append(currentTasks, task)
 		}
 	}
-	return currentTasks
+	return currentTasks, nil
 }
 
-// UpdateTask updates an existing task
-func UpdateTask(userID int, updatedTask Task) error {
-	for i, task := range manager.Tasks[userID] {
-		if task.ID == updatedTask.ID {
-			statusID, err := convertStringToStatusID(updatedTask.StatusString)
-			if err != nil {
-				return err
-			}
+// UpdateTask replaces an existing task and returns the updated task
+// Every field clients can write is replaced, and fields the update leaves out get the value a new
+// task would have. Fields only the task package sets, such as comments and the checklist, are kept.
+func UpdateTask(userID int, updatedTask Task) (Task, error) {
+	// Tasks in the trash are only changed by restoring them, like in checkPrecondition
+	task, err := GetTask(userID, updatedTask.ID)
+	if err != nil {
+		return Task{}, err
+	}
 
-			now := time.Now()
-			manager.Tasks[userID][i].Title = updatedTask.Title
-			manager.Tasks[userID][i].Description = updatedTask.Description
-			manager.Tasks[userID][i].StatusID = statusID
-			manager.Tasks[userID][i].StatusString = strings.ReplaceAll(updatedTask.StatusString, " ", "")
-			manager.Tasks[userID][i].UpdatedAt = &now
-			return nil
-		}
+	workflow := WorkflowFor(userID)
+	state, err := workflow.State(updatedTask.StatusString)
+	if err != nil {
+		return Task{}, err
 	}
-	return ErrTaskNotFound
+	if err := workflow.CheckTransition(task.stateName(), state.Name); err != nil {
+		return Task{}, err
+	}
+	priorityID, err := resolvePriority(updatedTask.PriorityString, DefaultPriority)
+	if err != nil {
+		return Task{}, err
+	}
+
+	now := time.Now()
+	previousStatus := task.StatusID
+	task.Title = updatedTask.Title
+	task.Description = updatedTask.Description
+	task.setState(state)
+	task.PriorityID = priorityID
+	task.PriorityString = priorityID.String()
+	if task.Tags, err = normalizeTags(updatedTask.Tags); err != nil {
+		return Task{}, &FieldError{Field: "tags", Err: err}
+	}
+	task.ParentID = updatedTask.ParentID
+	if err := validateParent(userID, task); err != nil {
+		return Task{}, err
+	}
+	task.BlockedBy = normalizeBlockers(updatedTask.BlockedBy)
+	if err := validateBlockers(userID, task); err != nil {
+		return Task{}, err
+	}
+	if err := checkBlocked(userID, previousStatus, task); err != nil {
+		return Task{}, err
+	}
+	task.DueDate = updatedTask.DueDate
+	if err := validateDueDate(task); err != nil {
+		return Task{}, err
+	}
+	task.Recurrence = updatedTask.Recurrence
+	if err := normalizeRecurrence(&task); err != nil {
+		return Task{}, err
+	}
+	task.Estimate, task.EstimateUnit = updatedTask.Estimate, updatedTask.EstimateUnit
+	if err := normalizeEstimate(&task); err != nil {
+		return Task{}, err
+	}
+	task.ChecklistAutoComplete = updatedTask.ChecklistAutoComplete
+	task.UpdatedAt = &now
+	return completeRecurring(userID, previousStatus, task)
 }
 
-// DeleteTask marks a task as deleted
+// MergeTask updates a task like UpdateTask, but keeps the current value of every field the update leaves empty
+// It serves clients of the legacy /update route, which only send the title, description and status.
+func MergeTask(userID int, updatedTask Task) (Task, error) {
+	task, err := GetTask(userID, updatedTask.ID)
+	if err != nil {
+		return Task{}, err
+	}
+	if updatedTask.StatusString == "" {
+		updatedTask.StatusString = task.stateName()
+	}
+	if updatedTask.PriorityString == "" {
+		updatedTask.PriorityString = task.PriorityString
+	}
+	if updatedTask.Tags == nil {
+		updatedTask.Tags = task.Tags
+	}
+	if updatedTask.ParentID == 0 {
+		updatedTask.ParentID = task.ParentID
+	}
+	if updatedTask.BlockedBy == nil {
+		updatedTask.BlockedBy = task.BlockedBy
+	}
+	if updatedTask.DueDate == nil {
+		updatedTask.DueDate = task.DueDate
+	}
+	if updatedTask.Recurrence == "" {
+		updatedTask.Recurrence = task.Recurrence
+	}
+	if updatedTask.Estimate == 0 && updatedTask.EstimateUnit == "" {
+		updatedTask.Estimate, updatedTask.EstimateUnit = task.Estimate, task.EstimateUnit
+	}
+	if !updatedTask.ChecklistAutoComplete {
+		updatedTask.ChecklistAutoComplete = task.ChecklistAutoComplete
+	}
+	return UpdateTask(userID, updatedTask)
+}
+
+// DeleteTask marks a task as deleted, leaving its subtasks as they are
+// Use DeleteTaskWithChildren to also handle the subtasks.
 func DeleteTask(userID int, taskID int) error {
 	now := time.Now()
 
-	for i, task := range manager.Tasks[userID] {
-		if task.ID == taskID && !task.Deleted {
-			manager.Tasks[userID][i].Deleted = true
-			manager.Tasks[userID][i].DeletedAt = &now
-			return nil
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return err
+	}
+
+	task.Deleted = true
+	task.DeletedAt = &now
+	// A deleted task is no longer worked on
+	stopTimers(&task, now)
+	_, err = saveTask(userID, task)
+	return err
+}
+
+// saveTask bumps the revision of an existing task, writes it to the store and records the change
+func saveTask(userID int, task Task) (Task, error) {
+	recorder := recorderFor(userID)
+	var before Task
+	if recorder != nil {
+		var err error
+		if before, err = GetStore().Get(userID, task.ID); err != nil {
+			return Task{}, err
 		}
 	}
 
-	return ErrTaskNotFound
+	task.Revision++
+	task.ChecklistProgress = nil
+	if err := GetStore().Update(userID, task); err != nil {
+		return Task{}, err
+	}
+	if recorder != nil {
+		recorder.record(task.ID, &before, &task)
+	}
+	return task, nil
 }
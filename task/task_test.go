@@ -1,6 +1,14 @@
 package task
 
 import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -13,7 +21,7 @@ func BenchmarkUpdateActorPattern(b *testing.B) {
 	InitChannel(1000)
 
 	response := make(chan Response)
-	RequestsChan <- Request{
+	Send(Request{
 		Action: CreateRequest,
 		Task: Task{
 			Title:        "Initial Task",
@@ -21,13 +29,13 @@ func BenchmarkUpdateActorPattern(b *testing.B) {
 			StatusString: "NotStarted",
 		},
 		Response: response,
-	}
+	})
 	<-response
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
 			response := make(chan Response)
-			RequestsChan <- Request{
+			Send(Request{
 				Action: UpdateRequest,
 				Task: Task{
 					ID:           1,
@@ -36,7 +44,7 @@ func BenchmarkUpdateActorPattern(b *testing.B) {
 					StatusString: "Started",
 				},
 				Response: response,
-			}
+			})
 			<-response
 		}
 	})
@@ -69,7 +77,7 @@ func BenchmarkCreateActorPattern(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
 			response := make(chan Response)
-			RequestsChan <- Request{
+			Send(Request{
 				Action: CreateRequest,
 				Task: Task{
 					Title:        "Benchmark Task",
@@ -77,12 +85,46 @@ func BenchmarkCreateActorPattern(b *testing.B) {
 					StatusString: "NotStarted",
 				},
 				Response: response,
-			}
+			})
+			<-response
+		}
+	})
+}
+
+// benchmarkCreateManyUsers creates tasks for a different user on every parallel goroutine,
+// so requests are spread over the shards started by InitShards
+func benchmarkCreateManyUsers(b *testing.B, numShards int) {
+	SetTasks(nil, nil)
+	InitShards(numShards, 1000)
+
+	var nextUserID atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		userID := int(nextUserID.Add(1))
+		for pb.Next() {
+			response := make(chan Response)
+			Send(Request{
+				UserID: userID,
+				Action: CreateRequest,
+				Task: Task{
+					Title:        "Benchmark Task",
+					Description:  "This is a benchmark task",
+					StatusString: "NotStarted",
+				},
+				Response: response,
+			})
 			<-response
 		}
 	})
 }
 
+func BenchmarkCreateActorPatternManyUsers(b *testing.B) {
+	benchmarkCreateManyUsers(b, 1)
+}
+
+func BenchmarkCreateShardedActorPattern(b *testing.B) {
+	benchmarkCreateManyUsers(b, runtime.GOMAXPROCS(0))
+}
+
 // Benchmark for the non-actor pattern
 func BenchmarkCreateNonActorPattern(b *testing.B) {
 	manager := &NonActorManager{}
@@ -107,10 +149,13 @@ func TestCreateTask(t *testing.T) {
 		StatusString: "Not Started",
 	}
 
-	err := CreateTask(1, task)
+	created, err := CreateTask(1, task)
 	if err != nil {
 		t.Fatalf("CreateTask failed: %v", err)
 	}
+	if created.ID != 1 {
+		t.Errorf("Expected created task ID to be 1, got %d", created.ID)
+	}
 
 	tasks, _ := GetManagerTasks()
 
@@ -137,7 +182,10 @@ func TestGetTasks(t *testing.T) {
 	}
 	SetTasks(taskToSave, map[int]int{})
 
-	tasks := GetTasks(1)
+	tasks, err := GetTasks(1)
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
 	if len(tasks) != 2 {
 		t.Fatalf("Expected 2 tasks, got %d", len(tasks))
 	}
@@ -147,6 +195,27 @@ func TestGetTasks(t *testing.T) {
 	}
 }
 
+func TestGetTask(t *testing.T) {
+	SetTasks(map[int][]Task{
+		1: {
+			{ID: 1, Title: "Task 1"},
+			{ID: 2, Title: "Task 2", Deleted: true},
+		},
+	}, map[int]int{1: 2})
+
+	task, err := GetTask(1, 1)
+	if err != nil || task.Title != "Task 1" {
+		t.Errorf("Expected task 1, got %+v and %v", task, err)
+	}
+
+	if _, err := GetTask(1, 2); err != ErrTaskNotFound {
+		t.Errorf("Expected ErrTaskNotFound for a deleted task, got %v", err)
+	}
+	if _, err := GetTask(1, 3); err != ErrTaskNotFound {
+		t.Errorf("Expected ErrTaskNotFound for a missing task, got %v", err)
+	}
+}
+
 func TestUpdateTask(t *testing.T) {
 	now := time.Now()
 	tasksToSave := map[int][]Task{
@@ -162,7 +231,7 @@ func TestUpdateTask(t *testing.T) {
 		StatusString: "Completed",
 	}
 
-	err := UpdateTask(1, updatedTask)
+	_, err := UpdateTask(1, updatedTask)
 	if err != nil {
 		t.Fatalf("UpdateTask failed: %v", err)
 	}
@@ -180,30 +249,1620 @@ func TestUpdateTask(t *testing.T) {
 	if tasks[1][0].UpdatedAt == nil {
 		t.Errorf("Expected UpdatedAt to be set, but it was nil")
 	}
+
+	// Tasks in the trash are not updated, with or without a precondition
+	DeleteTask(1, 1)
+	if _, err := UpdateTask(1, updatedTask); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for a deleted task, got %v", err)
+	}
+	if err := checkPrecondition(Request{Action: UpdateRequest, UserID: 1, Task: updatedTask, IfMatch: []int{2}}); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for a conditional update of a deleted task, got %v", err)
+	}
+	if err := DeleteTask(1, 1); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for deleting a deleted task, got %v", err)
+	}
 }
 
-func TestDeleteTask(t *testing.T) {
+func TestUpdateTaskReplacesFields(t *testing.T) {
+	SetTasks(nil, nil)
+	SetWorkflowConfig(WorkflowConfig{})
+
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	parent, _ := CreateTask(1, Task{Title: "Parent", StatusString: "NotStarted"})
+	blocker, _ := CreateTask(1, Task{Title: "Blocker", StatusString: "NotStarted"})
+	full, err := CreateTask(1, Task{
+		Title: "Full", Description: "Everything set", StatusString: "NotStarted", PriorityString: "Urgent",
+		Tags: []string{"work"}, ParentID: parent.ID, BlockedBy: []int{blocker.ID}, DueDate: &tomorrow,
+		Recurrence: "FREQ=DAILY", Estimate: 3, EstimateUnit: Points, ChecklistAutoComplete: true,
+		Checklist: []ChecklistItem{{Text: "Step"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if _, err := AddComment(1, full.ID, 1, "Kept"); err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+
+	// Every field the update leaves out is cleared or set back to its default
+	updated, err := UpdateTask(1, Task{ID: full.ID, Title: "Bare", StatusString: "NotStarted"})
+	if err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	for field, cleared := range map[string]bool{
+		"description":             updated.Description == "",
+		"priority":                updated.PriorityID == DefaultPriority,
+		"tags":                    len(updated.Tags) == 0,
+		"parent_id":               updated.ParentID == 0,
+		"blocked_by":              len(updated.BlockedBy) == 0,
+		"due_date":                updated.DueDate == nil,
+		"recurrence":              updated.Recurrence == "",
+		"estimate":                updated.Estimate == 0 && updated.EstimateUnit == "",
+		"checklist_auto_complete": !updated.ChecklistAutoComplete,
+	} {
+		if !cleared {
+			t.Errorf("Expected an update without %s to clear it, got %+v", field, updated)
+		}
+	}
+	// Fields only the task package sets are kept
+	if len(updated.Comments) != 1 || len(updated.Checklist) != 1 || !updated.CreatedAt.Equal(*full.CreatedAt) {
+		t.Errorf("Expected the update to keep comments, checklist and creation time, got %+v", updated)
+	}
+}
+
+func TestPatchTask(t *testing.T) {
 	now := time.Now()
-	taskToDelete := map[int][]Task{
+	SetTasks(map[int][]Task{
 		1: {
-			{ID: 1, Title: "Task 1", Deleted: false, CreatedAt: &now},
+			{ID: 1, Title: "Task 1", Description: "Description 1", StatusID: NotStarted, StatusString: "NotStarted", CreatedAt: &now},
+		},
+	}, map[int]int{1: 1})
+
+	patch, err := ParsePatch([]byte(`{"status": "Started", "due_date": "2030-01-02T15:04:05Z"}`))
+	if err != nil {
+		t.Fatalf("ParsePatch failed: %v", err)
+	}
+
+	patched, err := PatchTask(1, 1, patch)
+	if err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if patched.Title != "Task 1" || patched.Description != "Description 1" {
+		t.Errorf("Expected fields missing from the patch to be kept, got %+v", patched)
+	}
+	if patched.StatusID != Started || patched.StatusString != "Started" {
+		t.Errorf("Expected status to be Started, got %d %q", patched.StatusID, patched.StatusString)
+	}
+	if patched.DueDate == nil || patched.DueDate.Year() != 2030 {
+		t.Errorf("Expected due date to be set, got %v", patched.DueDate)
+	}
+
+	patch, _ = ParsePatch([]byte(`{"description": null, "due_date": null}`))
+	patched, _ = PatchTask(1, 1, patch)
+	if patched.Description != "" || patched.DueDate != nil {
+		t.Errorf("Expected null members to clear the fields, got %+v", patched)
+	}
+
+	patch, _ = ParsePatch([]byte(`{"status": "Unknown"}`))
+	_, err = PatchTask(1, 1, patch)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "status" {
+		t.Errorf("Expected a FieldError for status, got %v", err)
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	SetTasks(map[int][]Task{
+		1: {
+			{ID: 1, Title: "Write report", StatusID: NotStarted, CreatedAt: day(3), DueDate: day(10)},
+			{ID: 2, Title: "Read book", StatusID: Started, CreatedAt: day(1)},
+			{ID: 3, Title: "Review report", StatusID: Completed, CreatedAt: day(2), DueDate: day(5)},
+			{ID: 4, Title: "Deleted report", StatusID: NotStarted, CreatedAt: day(4), Deleted: true},
 		},
+	}, map[int]int{1: 4})
+
+	ids := func(tasks []Task) []int {
+		var ids []int
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
 	}
-	SetTasks(taskToDelete, map[int]int{1: 1})
 
-	err := DeleteTask(1, 1)
+	tests := []struct {
+		name     string
+		query    string
+		expected []int
+	}{
+		{"all", "", []int{1, 2, 3}},
+		{"status", "status=NotStarted,Completed", []int{1, 3}},
+		{"title", "title=REPORT", []int{1, 3}},
+		{"created range", "created_after=2020-01-02&created_before=2020-01-03", []int{3}},
+		{"due range", "due_before=2020-01-06", []int{3}},
+		{"sort by created_at", "sort=created_at", []int{2, 3, 1}},
+		{"sort by due_date descending", "sort=due_date&order=desc", []int{2, 1, 3}},
+		{"sort by title", "sort=title", []int{2, 3, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(test.query)
+			opts, err := ParseListOptions(query)
+			if err != nil {
+				t.Fatalf("ParseListOptions failed: %v", err)
+			}
+			tasks, next, err := ListTasks(1, opts)
+			if err != nil {
+				t.Fatalf("ListTasks failed: %v", err)
+			}
+			if !slices.Equal(ids(tasks), test.expected) || next != "" {
+				t.Errorf("Expected %v without a next page, got %v %q", test.expected, ids(tasks), next)
+			}
+		})
+	}
+
+	opts := ListOptions{Sort: SortByCreatedAt, Limit: 2}
+	page, next, err := ListTasks(1, opts)
+	if err != nil || !slices.Equal(ids(page), []int{2, 3}) || next == "" {
+		t.Fatalf("Expected the first page [2 3] with a cursor, got %v %q %v", ids(page), next, err)
+	}
+
+	// A task created between pages sorts after the cursor and shows up on the next page
+	if _, err := CreateTask(1, Task{Title: "New", StatusString: "NotStarted"}); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	opts.Cursor = next
+	page, next, err = ListTasks(1, opts)
+	if err != nil || !slices.Equal(ids(page), []int{1, 5}) || next != "" {
+		t.Errorf("Expected the last page [1 5], got %v %q %v", ids(page), next, err)
+	}
+
+	opts.Desc = true
+	if _, _, err := ListTasks(1, opts); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a cursor of another order, got %v", err)
+	}
+
+	for _, query := range []string{"sort=color", "order=up", "limit=-1", "status=", "due_after=tomorrow"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseListOptions(values); err == nil {
+			t.Errorf("Expected ParseListOptions(%q) to fail", query)
+		}
+	}
+	// Statuses depend on the workflow of the user, so unknown ones are only refused when listing
+	opts, _ = ParseListOptions(url.Values{"status": {"Done"}})
+	var fieldErr *FieldError
+	if _, _, err := ListTasks(1, opts); !errors.As(err, &fieldErr) || !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Expected an unknown status to be refused, got %v", err)
+	}
+}
+
+func TestDueDates(t *testing.T) {
+	SetTasks(nil, nil)
+	now := time.Now()
+	tomorrow := now.AddDate(0, 0, 1)
+
+	created, err := CreateTask(1, Task{Title: "Task 1", StatusString: "NotStarted", DueDate: &tomorrow})
 	if err != nil {
-		t.Fatalf("DeleteTask failed: %v", err)
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if created.DueDate == nil || !created.DueDate.Equal(tomorrow) {
+		t.Errorf("Expected the due date to be kept on create, got %v", created.DueDate)
 	}
 
-	tasks, _ := GetManagerTasks()
+	lastYear := now.AddDate(-1, 0, 0)
+	var fieldErr *FieldError
+	if _, err := CreateTask(1, Task{Title: "Task 2", StatusString: "NotStarted", DueDate: &lastYear}); !errors.As(err, &fieldErr) || !errors.Is(err, ErrInvalidDueDate) {
+		t.Errorf("Expected a due date before creation to be rejected, got %v", err)
+	}
+	if _, err := UpdateTask(1, Task{ID: 1, Title: "Task 1", StatusString: "NotStarted", DueDate: &time.Time{}}); !errors.Is(err, ErrInvalidDueDate) {
+		t.Errorf("Expected a zero due date to be rejected, got %v", err)
+	}
 
-	if !tasks[1][0].Deleted {
-		t.Errorf("Expected task to be marked as deleted, but it was not")
+	nextWeek := now.AddDate(0, 0, 8)
+	updated, err := UpdateTask(1, Task{ID: 1, Title: "Task 1", StatusString: "Started", DueDate: &nextWeek})
+	if err != nil || updated.DueDate == nil || !updated.DueDate.Equal(nextWeek) {
+		t.Errorf("Expected the due date to be replaced on update, got %v %v", updated.DueDate, err)
 	}
 
-	if tasks[1][0].DeletedAt == nil {
-		t.Errorf("Expected DeletedAt to be set, but it was nil")
+	yesterday := now.AddDate(0, 0, -1)
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
+	twoDaysAgo := now.AddDate(0, 0, -2)
+	SetTasks(map[int][]Task{
+		1: {
+			{ID: 1, Title: "Overdue", StatusID: Started, CreatedAt: &twoDaysAgo, DueDate: &yesterday},
+			{ID: 2, Title: "Done late", StatusID: Completed, CreatedAt: &twoDaysAgo, DueDate: &yesterday},
+			{ID: 3, Title: "Due later today", StatusID: NotStarted, CreatedAt: &twoDaysAgo, DueDate: &endOfToday},
+			{ID: 4, Title: "No due date", StatusID: NotStarted, CreatedAt: &twoDaysAgo},
+		},
+	}, map[int]int{1: 4})
+
+	opts, err := ParseListOptions(url.Values{"due": {DueOverdue}})
+	if err != nil {
+		t.Fatalf("ParseListOptions failed: %v", err)
+	}
+	tasks, _, _ := ListTasks(1, opts)
+	if len(tasks) != 1 || tasks[0].ID != 1 {
+		t.Errorf("Expected only task 1 to be overdue, got %+v", tasks)
+	}
+
+	opts, _ = ParseListOptions(url.Values{"due": {DueToday}})
+	tasks, _, _ = ListTasks(1, opts)
+	if len(tasks) != 1 || tasks[0].ID != 3 {
+		t.Errorf("Expected only task 3 to be due today, got %+v", tasks)
+	}
+
+	for _, query := range []url.Values{{"due": {"soon"}}, {"due": {DueToday}, "due_after": {"2030-01-01"}}} {
+		if _, err := ParseListOptions(query); err == nil {
+			t.Errorf("Expected ParseListOptions(%v) to fail", query)
+		}
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rule      string
+		canonical string
+		valid     bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", true},
+		{"rrule:freq=weekly;byday=su,mo,mo;interval=2", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU", true},
+		{"FREQ=MONTHLY;UNTIL=20301231", "FREQ=MONTHLY;UNTIL=20301231T235959Z", true},
+		{"FREQ=YEARLY;COUNT=3", "FREQ=YEARLY;COUNT=3", true},
+		{"", "", false},
+		{"INTERVAL=2", "", false},
+		{"FREQ=HOURLY", "", false},
+		{"FREQ=DAILY;INTERVAL=0", "", false},
+		{"FREQ=DAILY;BYDAY=MO", "", false},
+		{"FREQ=WEEKLY;BYDAY=XX", "", false},
+		{"FREQ=DAILY;COUNT=2;UNTIL=2030-01-01", "", false},
+		{"FREQ=DAILY;FREQ=WEEKLY", "", false},
+		{"FREQ=DAILY;BYMONTH=1", "", false},
+	}
+
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if !test.valid {
+			if !errors.Is(err, ErrInvalidRecurrence) {
+				t.Errorf("Expected %q to be rejected, got %v", test.rule, err)
+			}
+			continue
+		}
+		if err != nil || rule.String() != test.canonical {
+			t.Errorf("Expected %q to parse as %q, got %q %v", test.rule, test.canonical, rule.String(), err)
+		}
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	// 2030-01-31 is a Thursday
+	due := time.Date(2030, time.January, 31, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule     string
+		expected string
+	}{
+		{"FREQ=DAILY;INTERVAL=3", "2030-02-03"},
+		{"FREQ=WEEKLY", "2030-02-07"},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", "2030-02-01"},
+		{"FREQ=WEEKLY;BYDAY=MO,TU", "2030-02-04"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", "2030-02-11"},
+		{"FREQ=WEEKLY;BYDAY=SU", "2030-02-03"},
+		{"FREQ=MONTHLY", "2030-03-31"},
+		{"FREQ=YEARLY", "2031-01-31"},
+		{"FREQ=DAILY;UNTIL=2030-02-01", "2030-02-01"},
+		{"FREQ=DAILY;UNTIL=2030-01-31T12:00:00Z", ""},
+		{"FREQ=DAILY;COUNT=1", ""},
+	}
+
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if err != nil {
+			t.Fatalf("ParseRRule(%q) failed: %v", test.rule, err)
+		}
+		next, ok := rule.Next(due)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("Expected %q to have ended, got %v", test.rule, next)
+			}
+			continue
+		}
+		if !ok || next.Format(time.DateOnly) != test.expected || next.Hour() != 9 {
+			t.Errorf("Expected %q to be next due on %s at 9:00, got %v %v", test.rule, test.expected, next, ok)
+		}
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	SetTasks(nil, nil)
+	now := time.Now()
+	tomorrow := now.AddDate(0, 0, 1)
+
+	if _, err := CreateTask(1, Task{Title: "No due date", StatusString: "NotStarted", Recurrence: "FREQ=DAILY"}); !errors.Is(err, ErrInvalidRecurrence) {
+		t.Errorf("Expected a recurring task without due date to be rejected, got %v", err)
+	}
+	chore, err := CreateTask(1, Task{Title: "Water plants", StatusString: "NotStarted", PriorityString: "High", Tags: []string{"home"}, DueDate: &tomorrow, Recurrence: "freq=weekly;count=2"})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if chore.Recurrence != "FREQ=WEEKLY;COUNT=2" {
+		t.Errorf("Expected the rule to be stored in canonical form, got %q", chore.Recurrence)
+	}
+
+	completed, err := UpdateTask(1, Task{ID: chore.ID, Title: "Water plants", StatusString: "Completed", PriorityString: "High", Tags: []string{"home"}, DueDate: &tomorrow, Recurrence: chore.Recurrence})
+	if err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	if completed.Recurrence != chore.Recurrence || completed.NextOccurrence != 2 {
+		t.Fatalf("Expected the rule to be kept and task 2 to be the next occurrence, got %+v", completed)
+	}
+	next, err := GetTask(1, completed.NextOccurrence)
+	if err != nil {
+		t.Fatalf("GetTask failed: %v", err)
+	}
+	if next.StatusID != NotStarted || next.PriorityID != High || !slices.Equal(next.Tags, []string{"home"}) ||
+		!next.DueDate.Equal(tomorrow.AddDate(0, 0, 7)) || next.Recurrence != "FREQ=WEEKLY;COUNT=1" {
+		t.Errorf("Unexpected next occurrence %+v", next)
+	}
+
+	// Completing the completed task again, or after reopening it, does not spawn another occurrence
+	patch, _ := ParsePatch([]byte(`{"status": "Started"}`))
+	PatchTask(1, chore.ID, patch)
+	patch, _ = ParsePatch([]byte(`{"status": "Completed"}`))
+	PatchTask(1, chore.ID, patch)
+	// The last occurrence of the rule does not spawn one either
+	if last, err := PatchTask(1, next.ID, patch); err != nil || last.NextOccurrence != 0 {
+		t.Errorf("Expected the last occurrence to end the series, got %+v %v", last, err)
+	}
+	if tasks, _ := GetTasks(1); len(tasks) != 2 {
+		t.Errorf("Expected 2 tasks, got %d", len(tasks))
+	}
+
+	// Occurrences that passed while the task was open are skipped
+	weekAgo := now.AddDate(0, 0, -7)
+	SetTasks(map[int][]Task{
+		1: {{ID: 1, Title: "Daily standup", StatusID: Started, CreatedAt: &weekAgo, DueDate: &weekAgo, Recurrence: "FREQ=DAILY"}},
+	}, map[int]int{1: 1})
+	completed, err = PatchTask(1, 1, patch)
+	if err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	next, _ = GetTask(1, completed.NextOccurrence)
+	if next.DueDate == nil || next.DueDate.Format(time.DateOnly) != now.Format(time.DateOnly) {
+		t.Errorf("Expected the next occurrence to be due today, got %v", next.DueDate)
+	}
+
+	patch, _ = ParsePatch([]byte(`{"recurrence": null}`))
+	if stopped, err := PatchTask(1, next.ID, patch); err != nil || stopped.Recurrence != "" {
+		t.Errorf("Expected a null recurrence to stop the task recurring, got %q %v", stopped.Recurrence, err)
+	}
+}
+
+// failingUpdateStore is a Store whose updates fail
+type failingUpdateStore struct {
+	Store
+}
+
+func (failingUpdateStore) Update(userID int, task Task) error {
+	return errors.New("disk full")
+}
+
+func TestRecurrenceRemovesNextOccurrenceWhenSaveFails(t *testing.T) {
+	SetTasks(nil, nil)
+	defer SetTasks(nil, nil)
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	chore, err := CreateTask(1, Task{Title: "Water plants", StatusString: "NotStarted", DueDate: &tomorrow, Recurrence: "FREQ=WEEKLY"})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	SetStore(failingUpdateStore{GetStore()})
+	chore.StatusString = "Completed"
+	if _, err := UpdateTask(1, chore); err == nil {
+		t.Fatal("Expected completing the task to fail when it cannot be saved")
+	}
+	tasks, err := GetStore().List(1)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != chore.ID || tasks[0].StatusID == Completed {
+		t.Errorf("Expected only the uncompleted task to be left, got %+v", tasks)
+	}
+}
+
+func TestWorkflows(t *testing.T) {
+	config, err := ParseWorkflowConfig([]byte(`{
+		"workflows": {
+			"review": {
+				"states": [
+					{"name": "Open", "category": "NotStarted"},
+					{"name": "InProgress", "category": "Started"},
+					{"name": "InReview", "category": "Started"},
+					{"name": "Done", "category": "Completed"},
+					{"name": "Cancelled", "category": "Completed"}
+				],
+				"transitions": {
+					"Open": ["InProgress", "Cancelled"],
+					"InProgress": ["InReview", "Cancelled"],
+					"InReview": ["InProgress", "Done"]
+				}
+			}
+		},
+		"users": {"1": "review"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseWorkflowConfig failed: %v", err)
+	}
+	if err := SetWorkflowConfig(config); err != nil {
+		t.Fatalf("SetWorkflowConfig failed: %v", err)
+	}
+	defer SetWorkflowConfig(WorkflowConfig{})
+	SetTasks(nil, nil)
+
+	if _, err := CreateTask(1, Task{Title: "Task 1", StatusString: "NotStarted"}); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Expected a status of another workflow to be rejected, got %v", err)
+	}
+	created, err := CreateTask(1, Task{Title: "Task 1", StatusString: "Open"})
+	if err != nil || created.StatusID != NotStarted || created.StatusString != "Open" {
+		t.Fatalf("Expected the task to be Open, got %+v %v", created, err)
+	}
+	if other, err := CreateTask(2, Task{Title: "Task 1", StatusString: "NotStarted"}); err != nil || other.StatusString != "NotStarted" {
+		t.Errorf("Expected users without a workflow to keep the built-in statuses, got %+v %v", other, err)
+	}
+
+	_, err = UpdateTask(1, Task{ID: created.ID, Title: "Task 1", StatusString: "Done"})
+	var transitionErr *TransitionError
+	if !errors.As(err, &transitionErr) || !slices.Equal(transitionErr.Allowed, []string{"InProgress", "Cancelled"}) {
+		t.Fatalf("Expected a TransitionError allowing InProgress and Cancelled, got %v", err)
+	}
+	updated, err := UpdateTask(1, Task{ID: created.ID, Title: "Task 1", StatusString: "In Progress"})
+	if err != nil || updated.StatusID != Started || updated.StatusString != "InProgress" {
+		t.Fatalf("Expected the task to be InProgress, got %+v %v", updated, err)
+	}
+	patch, _ := ParsePatch([]byte(`{"status": "InReview"}`))
+	if _, err := PatchTask(1, created.ID, patch); err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	patch, _ = ParsePatch([]byte(`{"status": "Cancelled"}`))
+	if _, err := PatchTask(1, created.ID, patch); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+	patch, _ = ParsePatch([]byte(`{"status": "Done"}`))
+	done, err := PatchTask(1, created.ID, patch)
+	if err != nil || done.StatusID != Completed {
+		t.Fatalf("Expected the task to be completed, got %+v %v", done, err)
+	}
+	if _, err := UpdateTask(1, Task{ID: created.ID, Title: "Renamed", StatusString: "Done"}); err != nil {
+		t.Errorf("Expected a task to stay in a final state, got %v", err)
+	}
+	patch, _ = ParsePatch([]byte(`{"status": "Open"}`))
+	if _, err := PatchTask(1, created.ID, patch); err == nil || !strings.Contains(err.Error(), "allowed next statuses: none") {
+		t.Errorf("Expected Done to be final, got %v", err)
+	}
+
+	opts, _ := ParseListOptions(url.Values{"status": {"Done"}})
+	if tasks, _, err := ListTasks(1, opts); err != nil || len(tasks) != 1 {
+		t.Errorf("Expected the Done task to be listed, got %+v %v", tasks, err)
+	}
+
+	// Sorting by status follows the workflow, also between states of the same category, across pages
+	for _, status := range []string{"InReview", "InProgress", "InProgress"} {
+		if _, err := CreateTask(1, Task{Title: status, StatusString: status}); err != nil {
+			t.Fatalf("CreateTask failed: %v", err)
+		}
+	}
+	var sorted []int
+	opts = ListOptions{Sort: SortByStatus, Limit: 1}
+	for {
+		page, next, err := ListTasks(1, opts)
+		if err != nil {
+			t.Fatalf("ListTasks failed: %v", err)
+		}
+		for _, task := range page {
+			sorted = append(sorted, task.ID)
+		}
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+	if !slices.Equal(sorted, []int{3, 4, 2, 1}) {
+		t.Errorf("Expected the tasks in workflow order InProgress, InReview, Done, got IDs %v", sorted)
+	}
+
+	for _, invalid := range []string{
+		`{"workflows": {"w": {"states": []}}}`,
+		`{"workflows": {"w": {"states": [{"name": "In Review", "category": "Started"}]}}}`,
+		`{"workflows": {"w": {"states": [{"name": "A", "category": "Blocked"}]}}}`,
+		`{"workflows": {"w": {"states": [{"name": "A", "category": "Started"}, {"name": "A", "category": "Started"}]}}}`,
+		`{"workflows": {"w": {"states": [{"name": "A", "category": "Started"}], "transitions": {"A": ["B"]}}}}`,
+		`{"workflows": {}, "default": "w"}`,
+		`{"workflows": {}, "users": {"1": "w"}}`,
+		`{"workflow": {}}`,
+	} {
+		if _, err := ParseWorkflowConfig([]byte(invalid)); !errors.Is(err, ErrInvalidWorkflow) {
+			t.Errorf("Expected %s to be rejected, got %v", invalid, err)
+		}
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	SetTasks(nil, nil)
+
+	low, err := CreateTask(1, Task{Title: "Low", StatusString: "NotStarted", PriorityString: "low"})
+	if err != nil || low.PriorityID != Low || low.PriorityString != "Low" {
+		t.Fatalf("Expected priority Low, got %d %q %v", low.PriorityID, low.PriorityString, err)
+	}
+	medium, _ := CreateTask(1, Task{Title: "Medium", StatusString: "NotStarted"})
+	if medium.PriorityID != DefaultPriority {
+		t.Errorf("Expected the default priority, got %q", medium.PriorityString)
+	}
+	urgent, _ := CreateTask(1, Task{Title: "Urgent", StatusString: "NotStarted", PriorityString: "P0"})
+	if urgent.PriorityID != Urgent {
+		t.Errorf("Expected P0 to be Urgent, got %q", urgent.PriorityString)
+	}
+	if _, err := CreateTask(1, Task{Title: "Invalid", StatusString: "NotStarted", PriorityString: "P9"}); !errors.Is(err, ErrInvalidPriority) {
+		t.Errorf("Expected ErrInvalidPriority, got %v", err)
+	}
+
+	updated, err := UpdateTask(1, Task{ID: urgent.ID, Title: "Urgent", StatusString: "Started", PriorityString: "Urgent"})
+	if err != nil || updated.PriorityID != Urgent {
+		t.Errorf("Expected the update to keep the priority it names, got %q %v", updated.PriorityString, err)
+	}
+
+	patch, err := ParsePatch([]byte(`{"priority": "High"}`))
+	if err != nil {
+		t.Fatalf("ParsePatch failed: %v", err)
+	}
+	patched, err := PatchTask(1, low.ID, patch)
+	if err != nil || patched.PriorityID != High {
+		t.Errorf("Expected the patch to raise the priority to High, got %q %v", patched.PriorityString, err)
+	}
+
+	opts, err := ParseListOptions(url.Values{"sort": {SortByPriority}, "order": {"desc"}, "priority": {"High,Urgent"}})
+	if err != nil {
+		t.Fatalf("ParseListOptions failed: %v", err)
+	}
+	tasks, _, _ := ListTasks(1, opts)
+	if len(tasks) != 2 || tasks[0].ID != urgent.ID || tasks[1].ID != low.ID {
+		t.Errorf("Expected the urgent task before the high one, got %+v", tasks)
+	}
+}
+
+func TestTags(t *testing.T) {
+	SetTasks(nil, nil)
+
+	first, err := CreateTask(1, Task{Title: "Task 1", StatusString: "NotStarted", Tags: []string{"Work", " backend", "work"}})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if !slices.Equal(first.Tags, []string{"backend", "work"}) {
+		t.Errorf("Expected tags to be normalized, got %q", first.Tags)
+	}
+	second, _ := CreateTask(1, Task{Title: "Task 2", StatusString: "NotStarted", Tags: []string{"work"}})
+	third, _ := CreateTask(1, Task{Title: "Task 3", StatusString: "NotStarted"})
+
+	if _, err := CreateTask(1, Task{Title: "Task 4", StatusString: "NotStarted", Tags: []string{"a,b"}}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Expected ErrInvalidTag for a tag with a comma, got %v", err)
+	}
+
+	tagged, err := AddTags(1, third.ID, []string{"Home", "backend"})
+	if err != nil || !slices.Equal(tagged.Tags, []string{"backend", "home"}) {
+		t.Errorf("Expected the tags to be added, got %q %v", tagged.Tags, err)
+	}
+	untagged, err := RemoveTags(1, first.ID, []string{"WORK", "missing"})
+	if err != nil || !slices.Equal(untagged.Tags, []string{"backend"}) {
+		t.Errorf("Expected the tag to be removed, got %q %v", untagged.Tags, err)
+	}
+	updated, _ := UpdateTask(1, Task{ID: second.ID, Title: "Task 2", StatusString: "Started", Tags: []string{"Work"}})
+	if !slices.Equal(updated.Tags, []string{"work"}) {
+		t.Errorf("Expected the update to replace the tags, got %q", updated.Tags)
+	}
+
+	counts, err := GetTagCounts(1)
+	expected := []TagCount{{Tag: "backend", Count: 2}, {Tag: "home", Count: 1}, {Tag: "work", Count: 1}}
+	if err != nil || !slices.Equal(counts, expected) {
+		t.Errorf("Expected tag counts %v, got %v %v", expected, counts, err)
+	}
+
+	ids := func(query string) []int {
+		values, _ := url.ParseQuery(query)
+		opts, err := ParseListOptions(values)
+		if err != nil {
+			t.Fatalf("ParseListOptions(%q) failed: %v", query, err)
+		}
+		tasks, _, _ := ListTasks(1, opts)
+		var ids []int
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+	if got := ids("tags_all=backend,home"); !slices.Equal(got, []int{third.ID}) {
+		t.Errorf("Expected only task 3 to have both tags, got %v", got)
+	}
+	if got := ids("tags_any=home,work"); !slices.Equal(got, []int{second.ID, third.ID}) {
+		t.Errorf("Expected tasks 2 and 3 to have either tag, got %v", got)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	SetTasks(nil, nil)
+
+	root, _ := CreateTask(1, Task{Title: "Root", StatusString: "Started"})
+	child, err := CreateTask(1, Task{Title: "Child", StatusString: "Completed", ParentID: root.ID})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	grandchild, _ := CreateTask(1, Task{Title: "Grandchild", StatusString: "NotStarted", ParentID: child.ID})
+	other, _ := CreateTask(1, Task{Title: "Other", StatusString: "NotStarted"})
+
+	if _, err := CreateTask(1, Task{Title: "Orphan", StatusString: "NotStarted", ParentID: 99}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected ErrInvalidParent, got %v", err)
+	}
+	patch, _ := ParsePatch([]byte(`{"parent_id": 3}`))
+	if _, err := PatchTask(1, root.ID, patch); !errors.Is(err, ErrParentCycle) {
+		t.Errorf("Expected moving a task under its grandchild to fail with ErrParentCycle, got %v", err)
+	}
+
+	tree, err := GetTaskTree(1, ListOptions{})
+	if err != nil {
+		t.Fatalf("GetTaskTree failed: %v", err)
+	}
+	if len(tree) != 2 || tree[0].ID != root.ID || tree[0].Children[0].Children[0].ID != grandchild.ID {
+		t.Fatalf("Unexpected tree: %+v", tree)
+	}
+	if progress := tree[0].Progress; progress == nil || progress.Completed != 1 || progress.Total != 2 || progress.Percent != 50 {
+		t.Errorf("Expected the root to have 1 of 2 subtasks done, got %+v", progress)
+	}
+	if _, err := GetTaskTree(1, ListOptions{Limit: 1}); err == nil {
+		t.Error("Expected the tree view to refuse paging")
+	}
+
+	if err := DeleteTaskWithChildren(1, root.ID, RestrictChildren); !errors.Is(err, ErrHasChildren) {
+		t.Errorf("Expected ErrHasChildren, got %v", err)
+	}
+	if err := DeleteTaskWithChildren(1, child.ID, DetachChildren); err != nil {
+		t.Fatalf("DeleteTaskWithChildren failed: %v", err)
+	}
+	if moved, _ := GetTask(1, grandchild.ID); moved.ParentID != root.ID {
+		t.Errorf("Expected the grandchild to move up to the root, got parent %d", moved.ParentID)
+	}
+
+	patch, _ = ParsePatch([]byte(`{"parent_id": 4}`))
+	if _, err := PatchTask(1, root.ID, patch); err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if err := DeleteTaskWithChildren(1, other.ID, CascadeChildren); err != nil {
+		t.Fatalf("DeleteTaskWithChildren failed: %v", err)
+	}
+	if tasks, _ := GetTasks(1); len(tasks) != 0 {
+		t.Errorf("Expected the cascade to delete every descendant, got %+v", tasks)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	SetTasks(nil, nil)
+	defer SetBlockStart(false)
+
+	design, _ := CreateTask(1, Task{Title: "Design", StatusString: "Started", PriorityString: "Low"})
+	build, err := CreateTask(1, Task{Title: "Build", StatusString: "NotStarted", BlockedBy: []int{design.ID, design.ID}})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if !slices.Equal(build.BlockedBy, []int{design.ID}) {
+		t.Errorf("Expected duplicate blockers to be removed, got %v", build.BlockedBy)
+	}
+	ship, _ := CreateTask(1, Task{Title: "Ship", StatusString: "NotStarted", BlockedBy: []int{build.ID}})
+	docs, _ := CreateTask(1, Task{Title: "Docs", StatusString: "NotStarted", PriorityString: "High"})
+
+	if _, err := CreateTask(1, Task{Title: "Invalid", StatusString: "NotStarted", BlockedBy: []int{42}}); !errors.Is(err, ErrInvalidDependency) {
+		t.Errorf("Expected ErrInvalidDependency, got %v", err)
+	}
+	patch, _ := ParsePatch([]byte(`{"blocked_by": [3]}`))
+	if _, err := PatchTask(1, design.ID, patch); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("Expected ErrDependencyCycle, got %v", err)
+	}
+
+	_, err = UpdateTask(1, Task{ID: build.ID, Title: "Build", StatusString: "Completed", BlockedBy: build.BlockedBy})
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || !slices.Equal(blocked.Blockers, []int{design.ID}) {
+		t.Fatalf("Expected a BlockedError naming the design task, got %v", err)
+	}
+	if _, err := UpdateTask(1, Task{ID: build.ID, Title: "Build", StatusString: "Started", BlockedBy: build.BlockedBy}); err != nil {
+		t.Errorf("Expected a blocked task to be startable by default, got %v", err)
+	}
+	SetBlockStart(true)
+	patch, _ = ParsePatch([]byte(`{"status": "Started"}`))
+	if _, err := PatchTask(1, ship.ID, patch); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected ErrBlocked when starting is blocked too, got %v", err)
+	}
+
+	next, _ := GetNextTasks(1)
+	if len(next) != 2 || next[0].ID != docs.ID || next[1].ID != design.ID {
+		t.Errorf("Expected docs and design to be next, got %+v", next)
+	}
+	graph, _ := GetDependencyGraph(1)
+	if !slices.Equal(graph.Order, []int{docs.ID, design.ID, build.ID, ship.ID}) || len(graph.Edges) != 2 {
+		t.Errorf("Unexpected graph order %v and edges %v", graph.Order, graph.Edges)
+	}
+
+	patch, _ = ParsePatch([]byte(`{"status": "Completed"}`))
+	if _, err := PatchTask(1, design.ID, patch); err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if _, err := PatchTask(1, build.ID, patch); err != nil {
+		t.Errorf("Expected the build to be completable once the design is, got %v", err)
+	}
+
+	// A blocker in the trash stays in blocked_by, so resending it unchanged is accepted
+	if err := DeleteTask(1, docs.ID); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+	patch, _ = ParsePatch([]byte(`{"blocked_by": [4]}`))
+	if _, err := PatchTask(1, ship.ID, patch); err != nil {
+		t.Fatalf("Expected a deleted blocker to be accepted, got %v", err)
+	}
+	patch, _ = ParsePatch([]byte(`{"title": "Ship it", "blocked_by": [4]}`))
+	if _, err := PatchTask(1, ship.ID, patch); err != nil {
+		t.Errorf("Expected a dependent of a deleted task to stay editable, got %v", err)
+	}
+	if _, err := UpdateTask(1, Task{ID: ship.ID, Title: "Ship", StatusString: "Completed", BlockedBy: []int{docs.ID}}); err != nil {
+		t.Errorf("Expected a deleted blocker not to block, got %v", err)
+	}
+}
+
+func TestRevisionPrecondition(t *testing.T) {
+	InitChannel(10)
+	SetTasks(nil, nil)
+
+	created, err := CreateTask(1, Task{Title: "Task 1", StatusString: "NotStarted"})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if created.Revision != 1 {
+		t.Fatalf("Expected a new task to be at revision 1, got %d", created.Revision)
+	}
+
+	title := "Task 1 updated"
+	res, err := Submit(context.Background(), Request{UserID: 1, Action: PatchRequest, TaskID: 1, Patch: Patch{Title: &title}, IfMatch: []int{1}})
+	if err != nil || res.Error != nil {
+		t.Fatalf("Expected the patch at the current revision to succeed, got %v %v", err, res.Error)
+	}
+	if res.Tasks[0].Revision != 2 {
+		t.Errorf("Expected the revision to be bumped to 2, got %d", res.Tasks[0].Revision)
+	}
+
+	res, err = Submit(context.Background(), Request{UserID: 1, Action: DeleteRequest, TaskID: 1, IfMatch: []int{1}})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	var mismatch *RevisionMismatchError
+	if !errors.As(res.Error, &mismatch) || mismatch.Current.Revision != 2 {
+		t.Fatalf("Expected a RevisionMismatchError at revision 2, got %v", res.Error)
+	}
+	if task, _ := GetTask(1, 1); task.Deleted {
+		t.Error("Expected a stale delete to leave the task in place")
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	tests := []struct {
+		patch         string
+		expectedField string
+		expectedErr   error
+	}{
+		{`{"id": 2}`, "id", ErrReadOnlyField},
+		{`{"owner": "me"}`, "owner", ErrUnknownField},
+		{`{"title": null}`, "title", ErrNullField},
+		{`{"priority": null}`, "priority", ErrNullField},
+		{`{"priority_id": 4}`, "priority_id", ErrReadOnlyField},
+		{`{"parent_id": "1"}`, "parent_id", nil},
+		{`{"blocked_by": 1}`, "blocked_by", nil},
+		{`{"recurrence": 1}`, "recurrence", nil},
+		{`{"next_occurrence": 3}`, "next_occurrence", ErrReadOnlyField},
+		{`{"title": 5}`, "title", nil},
+		{`{"due_date": "tomorrow"}`, "due_date", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.patch, func(t *testing.T) {
+			_, err := ParsePatch([]byte(test.patch))
+
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("Expected a FieldError, got %v", err)
+			}
+			if fieldErr.Field != test.expectedField {
+				t.Errorf("Expected field %q, got %q", test.expectedField, fieldErr.Field)
+			}
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Errorf("Expected %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestDeleteTask(t *testing.T) {
+	now := time.Now()
+	taskToDelete := map[int][]Task{
+		1: {
+			{ID: 1, Title: "Task 1", Deleted: false, CreatedAt: &now},
+		},
+	}
+	SetTasks(taskToDelete, map[int]int{1: 1})
+
+	err := DeleteTask(1, 1)
+	if err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+
+	tasks, _ := GetManagerTasks()
+
+	if !tasks[1][0].Deleted {
+		t.Errorf("Expected task to be marked as deleted, but it was not")
+	}
+
+	if tasks[1][0].DeletedAt == nil {
+		t.Errorf("Expected DeletedAt to be set, but it was nil")
+	}
+}
+
+func TestTrash(t *testing.T) {
+	now := time.Now()
+	hourAgo := now.Add(-time.Hour)
+	weekAgo := now.AddDate(0, 0, -7)
+	SetTasks(map[int][]Task{
+		1: {
+			{ID: 1, Title: "Parent", StatusID: NotStarted, CreatedAt: &weekAgo, Deleted: true, DeletedAt: &weekAgo},
+			{ID: 2, Title: "Child", StatusID: NotStarted, CreatedAt: &weekAgo, ParentID: 1, Deleted: true, DeletedAt: &hourAgo},
+			{ID: 3, Title: "Open", StatusID: NotStarted, CreatedAt: &weekAgo, BlockedBy: []int{1, 2}},
+			{ID: 4, Title: "Old", StatusID: NotStarted, CreatedAt: &weekAgo, Deleted: true, DeletedAt: &weekAgo},
+		},
+	}, map[int]int{1: 4})
+	ids := func(tasks []Task) []int {
+		var ids []int
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	trash, err := GetDeletedTasks(1)
+	if err != nil || !slices.Equal(ids(trash), []int{2, 1, 4}) {
+		t.Errorf("Expected the trash [2 1 4], got %v %v", ids(trash), err)
+	}
+
+	restored, err := RestoreTask(1, 2)
+	if err != nil {
+		t.Fatalf("RestoreTask failed: %v", err)
+	}
+	if restored.Deleted || restored.DeletedAt != nil || restored.ParentID != 0 {
+		t.Errorf("Expected the child to be restored to the top level, got %+v", restored)
+	}
+	if _, err := RestoreTask(1, 2); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("Expected ErrNotDeleted when restoring a task that is not deleted, got %v", err)
+	}
+	if err := PurgeTask(1, 3); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("Expected ErrNotDeleted when purging a task that is not deleted, got %v", err)
+	}
+
+	if err := PurgeTask(1, 1); err != nil {
+		t.Fatalf("PurgeTask failed: %v", err)
+	}
+	if _, err := GetStore().Get(1, 1); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected the task to be gone, got %v", err)
+	}
+	if open, _ := GetTask(1, 3); !slices.Equal(open.BlockedBy, []int{2}) {
+		t.Errorf("Expected the purged blocker to be dropped, got %v", open.BlockedBy)
+	}
+	if _, err := RestoreTask(1, 1); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected a purged task not to be restorable, got %v", err)
+	}
+
+	purged, err := PurgeDeletedBefore(1, now.AddDate(0, 0, -1))
+	if err != nil || !slices.Equal(ids(purged), []int{4}) {
+		t.Errorf("Expected task 4 to expire, got %v %v", ids(purged), err)
+	}
+	if tasks, _ := GetStore().List(1); len(tasks) != 2 {
+		t.Errorf("Expected 2 tasks to be left, got %+v", tasks)
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	SetTasks(nil, nil)
+	SetWorkflowConfig(WorkflowConfig{})
+
+	created, err := CreateTask(1, Task{Title: "Task 1", StatusString: "NotStarted", Checklist: []ChecklistItem{{ID: 7, Text: " Pack "}, {Text: "Go", Done: true}}})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if created.MaxChecklistItemID != 2 || created.Checklist[0] != (ChecklistItem{ID: 1, Text: "Pack"}) ||
+		*checklistProgress(created.Checklist) != (Progress{Completed: 1, Total: 2, Percent: 50}) {
+		t.Errorf("Unexpected checklist of the new task %+v", created.Checklist)
+	}
+	if _, err := CreateTask(1, Task{Title: "Task 2", StatusString: "NotStarted", Checklist: []ChecklistItem{{Text: " "}}}); !errors.Is(err, ErrInvalidChecklistItem) {
+		t.Errorf("Expected ErrInvalidChecklistItem for an empty item, got %v", err)
+	}
+
+	task, err := AddChecklistItem(1, 1, "Return")
+	if err != nil || len(task.Checklist) != 3 || task.Checklist[2].ID != 3 || checklistProgress(task.Checklist).Percent != 33 {
+		t.Fatalf("Unexpected checklist after adding an item %+v: %v", task.Checklist, err)
+	}
+	task, _ = MoveChecklistItem(1, 1, 3, 0)
+	if ids := []int{task.Checklist[0].ID, task.Checklist[1].ID, task.Checklist[2].ID}; !slices.Equal(ids, []int{3, 1, 2}) {
+		t.Errorf("Expected item 3 to move to the front, got %v", ids)
+	}
+	task, _ = MoveChecklistItem(1, 1, 3, 10)
+	if task.Checklist[2].ID != 3 {
+		t.Errorf("Expected a position past the end to move the item to the end, got %+v", task.Checklist)
+	}
+	if _, err := MoveChecklistItem(1, 1, 3, -1); !errors.Is(err, ErrInvalidChecklistItem) {
+		t.Errorf("Expected ErrInvalidChecklistItem for a negative position, got %v", err)
+	}
+	task, _ = RemoveChecklistItem(1, 1, 3)
+	if len(task.Checklist) != 2 || checklistProgress(task.Checklist).Total != 2 {
+		t.Errorf("Unexpected checklist after removing an item %+v", task.Checklist)
+	}
+	if _, err := ToggleChecklistItem(1, 1, 3); !errors.Is(err, ErrChecklistItemNotFound) {
+		t.Errorf("Expected ErrChecklistItemNotFound for a removed item, got %v", err)
+	}
+
+	// Without auto-completion checking every item leaves the status alone
+	task, _ = ToggleChecklistItem(1, 1, 1)
+	if checklistProgress(task.Checklist).Percent != 100 || task.StatusID != NotStarted {
+		t.Errorf("Expected a fully checked task to stay NotStarted, got %v %+v", task.StatusString, task.Checklist)
+	}
+	task, _ = ToggleChecklistItem(1, 1, 1)
+
+	enabled := true
+	if _, err := PatchTask(1, 1, Patch{ChecklistAutoComplete: &enabled}); err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	task, _ = ToggleChecklistItem(1, 1, 1)
+	if task.StatusID != Completed || task.StatusString != "Completed" {
+		t.Errorf("Expected checking the last item to complete the task, got %v", task.StatusString)
+	}
+	task, _ = ToggleChecklistItem(1, 1, 1)
+	if task.StatusID != Completed {
+		t.Errorf("Expected unchecking an item to leave the task completed, got %v", task.StatusString)
+	}
+
+	// An open blocker keeps the task from completing
+	CreateTask(1, Task{Title: "Blocker", StatusString: "NotStarted"})
+	CreateTask(1, Task{Title: "Blocked", StatusString: "NotStarted", BlockedBy: []int{2}, ChecklistAutoComplete: true, Checklist: []ChecklistItem{{Text: "Wait"}}})
+	task, err = ToggleChecklistItem(1, 3, 1)
+	if err != nil || task.StatusID != NotStarted || !task.Checklist[0].Done {
+		t.Errorf("Expected the blocked task to stay open with its item checked, got %+v: %v", task, err)
+	}
+
+	// The next occurrence of a recurring task starts with its checklist unchecked
+	due := time.Now().Add(24 * time.Hour)
+	CreateTask(1, Task{Title: "Weekly", StatusString: "NotStarted", DueDate: &due, Recurrence: "FREQ=WEEKLY", ChecklistAutoComplete: true, Checklist: []ChecklistItem{{Text: "Review"}}})
+	task, _ = ToggleChecklistItem(1, 4, 1)
+	next, err := GetTask(1, task.NextOccurrence)
+	if err != nil || len(next.Checklist) != 1 || next.Checklist[0].Done || checklistProgress(next.Checklist).Completed != 0 || !next.ChecklistAutoComplete {
+		t.Errorf("Expected an unchecked checklist on the next occurrence, got %+v: %v", next, err)
+	}
+
+	// The progress is only computed for responses, so it never goes stale in the store
+	if stored, _ := GetStore().Get(1, 1); stored.ChecklistProgress != nil {
+		t.Errorf("Expected no checklist progress to be stored, got %+v", stored.ChecklistProgress)
+	}
+	InitChannel(10)
+	res, err := Submit(context.Background(), Request{UserID: 1, Action: GetTaskRequest, TaskID: 1})
+	if err != nil || res.Error != nil || res.Tasks[0].ChecklistProgress == nil || res.Tasks[0].ChecklistProgress.Total != 2 {
+		t.Errorf("Expected the response to carry the checklist progress, got %+v: %v %v", res.Tasks, err, res.Error)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	SetTasks(map[int][]Task{1: {{ID: 1, Title: "Task 1", StatusID: NotStarted, Revision: 1}, {ID: 2, Title: "Task 2", StatusID: NotStarted, Revision: 1}}}, map[int]int{1: 2})
+	blobs := NewMemoryBlobs()
+	SetBlobStore(blobs)
+	SetAttachmentQuota(10)
+	defer SetAttachmentQuota(0)
+
+	put := func(content string) Attachment {
+		digest, size, err := blobs.Put(1, strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		return Attachment{Name: "notes.txt", ContentType: "text/plain; charset=utf-8", Size: size, SHA256: digest}
+	}
+
+	notes := put("12345678")
+	added, err := AddAttachment(1, 1, notes)
+	if err != nil || added.ID != 1 || added.CreatedAt == nil {
+		t.Fatalf("Unexpected attachment %+v: %v", added, err)
+	}
+	// The same content on another task counts once
+	if _, err := AddAttachment(1, 2, notes); err != nil {
+		t.Errorf("Expected the same content to fit the quota again, got %v", err)
+	}
+	extra := put("123")
+	if _, err := AddAttachment(1, 1, extra); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if ok, _ := blobs.Has(1, extra.SHA256); ok {
+		t.Error("Expected the content of a refused attachment to be released")
+	}
+	if _, err := AddAttachment(1, 1, Attachment{Name: "gone.txt", SHA256: extra.SHA256}); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment for content that is not stored, got %v", err)
+	}
+	if _, err := AddAttachment(1, 1, Attachment{Name: " ", SHA256: notes.SHA256}); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment without a name, got %v", err)
+	}
+
+	created, _ := CreateTask(1, Task{Title: "Task 3", StatusString: "NotStarted", Attachments: []Attachment{added}, MaxAttachmentID: 1})
+	if created.Attachments != nil || created.MaxAttachmentID != 0 {
+		t.Errorf("Expected a new task to start without attachments, got %+v", created.Attachments)
+	}
+
+	DeleteTask(1, 1)
+	if err := PurgeTask(1, 1); err != nil {
+		t.Fatalf("PurgeTask failed: %v", err)
+	}
+	if ok, _ := blobs.Has(1, notes.SHA256); !ok {
+		t.Fatal("Expected the content to be kept while task 2 uses it")
+	}
+	if err := RemoveAttachment(1, 2, 1); err != nil {
+		t.Fatalf("RemoveAttachment failed: %v", err)
+	}
+	if ok, _ := blobs.Has(1, notes.SHA256); ok {
+		t.Error("Expected removing the last attachment to delete the content")
+	}
+}
+
+func TestTimeTracking(t *testing.T) {
+	SetTasks(map[int][]Task{1: {
+		{ID: 1, Title: "Task 1", StatusID: NotStarted, StatusString: "NotStarted", Tags: []string{"billing", "work"}, Revision: 1},
+		{ID: 2, Title: "Task 2", StatusID: NotStarted, StatusString: "NotStarted", Revision: 1},
+	}}, map[int]int{1: 2})
+	SetWorkflowConfig(WorkflowConfig{})
+
+	timer, err := StartTimer(1, 1, " Fixing ")
+	if err != nil || timer.TaskID != 1 || timer.ID != 1 || timer.Stop != nil || timer.Note != "Fixing" {
+		t.Fatalf("Unexpected timer %+v: %v", timer, err)
+	}
+	if task, _ := GetTask(1, 1); task.StatusID != Started || task.StatusString != "Started" {
+		t.Errorf("Expected starting a timer to start the task, got %v", task.StatusString)
+	}
+	if _, err := StartTimer(1, 2, ""); !errors.Is(err, ErrTimerRunning) {
+		t.Errorf("Expected ErrTimerRunning for a second timer, got %v", err)
+	}
+	if running, err := GetTimer(1); err != nil || running.TaskID != 1 {
+		t.Errorf("Expected the timer of task 1 to run, got %+v: %v", running, err)
+	}
+	stopped, err := StopTimer(1)
+	if err != nil || stopped.Stop == nil || stopped.Duration < 0 {
+		t.Fatalf("Unexpected stopped timer %+v: %v", stopped, err)
+	}
+	if _, err := StopTimer(1); !errors.Is(err, ErrNoTimer) {
+		t.Errorf("Expected ErrNoTimer once the timer stopped, got %v", err)
+	}
+
+	// Deleting a task stops its timer
+	StartTimer(1, 2, "")
+	DeleteTask(1, 2)
+	if _, err := GetTimer(1); !errors.Is(err, ErrNoTimer) {
+		t.Errorf("Expected deleting the task to stop its timer, got %v", err)
+	}
+	RestoreTask(1, 2)
+
+	start := time.Date(2026, 1, 5, 23, 0, 0, 0, time.Local)
+	stop := start.Add(2 * time.Hour)
+	entry, err := LogTime(1, 1, TimeEntry{Start: start, Stop: &stop, Note: "Night shift"})
+	if err != nil || entry.ID != 2 || entry.Duration != 7200 {
+		t.Fatalf("Unexpected logged entry %+v: %v", entry, err)
+	}
+	short := start.Add(30 * time.Minute)
+	LogTime(1, 2, TimeEntry{Start: start, Stop: &short})
+	if _, err := LogTime(1, 1, TimeEntry{Start: start, Stop: &start}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry for an empty span, got %v", err)
+	}
+	if _, err := LogTime(1, 1, TimeEntry{Stop: &stop}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry without a start, got %v", err)
+	}
+
+	from, to := start, start.Add(24*time.Hour)
+	report := func(group string) TimeReport {
+		t.Helper()
+		report, err := GetTimeReport(1, TimeReportOptions{From: &from, To: &to, GroupBy: group})
+		if err != nil {
+			t.Fatalf("GetTimeReport failed: %v", err)
+		}
+		return report
+	}
+	if byTask := report(GroupByTask); byTask.TotalSeconds != 9000 || len(byTask.Rows) != 2 ||
+		byTask.Rows[0] != (TimeReportRow{Key: "1", Title: "Task 1", Seconds: 7200}) {
+		t.Errorf("Unexpected report by task %+v", byTask)
+	}
+	if byTag := report(GroupByTag); byTag.TotalSeconds != 9000 || len(byTag.Rows) != 3 ||
+		byTag.Rows[0].Seconds != 7200 || byTag.Rows[2] != (TimeReportRow{Key: "", Seconds: 1800}) {
+		t.Errorf("Unexpected report by tag %+v", byTag)
+	}
+	if byDay := report(GroupByDay); len(byDay.Rows) != 2 ||
+		byDay.Rows[0] != (TimeReportRow{Key: "2026-01-05", Seconds: 5400}) || byDay.Rows[1] != (TimeReportRow{Key: "2026-01-06", Seconds: 3600}) {
+		t.Errorf("Expected the night shift to be split at midnight, got %+v", byDay)
+	}
+	to = start.Add(time.Hour)
+	if clipped := report(GroupByTask); clipped.TotalSeconds != 5400 {
+		t.Errorf("Expected entries to be cut at the end of the range, got %+v", clipped)
+	}
+
+	if err := DeleteTimeEntry(1, 1, 2); err != nil {
+		t.Fatalf("DeleteTimeEntry failed: %v", err)
+	}
+	if err := DeleteTimeEntry(1, 1, 2); !errors.Is(err, ErrTimeEntryNotFound) {
+		t.Errorf("Expected ErrTimeEntryNotFound for a deleted entry, got %v", err)
+	}
+
+	for query, field := range map[string]string{"group=week": "group", "from=yesterday": "from", "from=2026-01-02&to=2026-01-01": "to"} {
+		values, _ := url.ParseQuery(query)
+		var fieldErr *FieldError
+		if _, err := ParseTimeReportOptions(values); !errors.As(err, &fieldErr) || fieldErr.Field != field {
+			t.Errorf("Expected a %s error for %q, got %v", field, query, err)
+		}
+	}
+}
+
+func TestEstimates(t *testing.T) {
+	SetTasks(map[int][]Task{}, map[int]int{})
+	SetWorkflowConfig(WorkflowConfig{})
+
+	created, err := CreateTask(1, Task{Title: "Estimated", StatusString: "NotStarted", Estimate: 5})
+	if err != nil || created.Estimate != 5 || created.EstimateUnit != Hours {
+		t.Fatalf("Expected the estimate to default to hours, got %v %q: %v", created.Estimate, created.EstimateUnit, err)
+	}
+	for _, invalid := range []Task{{Estimate: -1}, {Estimate: math.NaN()}, {Estimate: 2, EstimateUnit: "days"}} {
+		invalid.Title, invalid.StatusString = "Invalid", "NotStarted"
+		if _, err := CreateTask(1, invalid); !errors.Is(err, ErrInvalidEstimate) {
+			t.Errorf("Expected ErrInvalidEstimate for %v %q, got %v", invalid.Estimate, invalid.EstimateUnit, err)
+		}
+	}
+
+	// Patches change or remove the estimate
+	updated, err := UpdateTask(1, Task{ID: created.ID, Title: "Estimated", StatusString: "NotStarted", Estimate: 5})
+	if err != nil || updated.Estimate != 5 || updated.EstimateUnit != Hours {
+		t.Errorf("Expected the update to keep the estimate in hours, got %v %q: %v", updated.Estimate, updated.EstimateUnit, err)
+	}
+	patch, _ := ParsePatch([]byte(`{"estimate": 3, "estimate_unit": "points"}`))
+	if patched, err := PatchTask(1, created.ID, patch); err != nil || patched.Estimate != 3 || patched.EstimateUnit != Points {
+		t.Errorf("Unexpected patched estimate %v %q: %v", patched.Estimate, patched.EstimateUnit, err)
+	}
+	patch, _ = ParsePatch([]byte(`{"estimate": null}`))
+	if patched, err := PatchTask(1, created.ID, patch); err != nil || patched.Estimate != 0 || patched.EstimateUnit != "" {
+		t.Errorf("Expected a null estimate to remove it, got %v %q: %v", patched.Estimate, patched.EstimateUnit, err)
+	}
+
+	SetTasks(map[int][]Task{1: {
+		{ID: 1, Title: "Under", StatusID: Started, Estimate: 5, EstimateUnit: Hours, Revision: 1},
+		{ID: 2, Title: "Over", StatusID: Started, Estimate: 1, EstimateUnit: Hours, Revision: 1},
+		{ID: 3, Title: "Done", StatusID: Completed, Estimate: 8, EstimateUnit: Points, Revision: 1},
+		{ID: 4, Title: "Open", StatusID: NotStarted, Estimate: 5, EstimateUnit: Points, Revision: 1},
+		{ID: 5, Title: "Unestimated", StatusID: NotStarted, Revision: 1},
+		{ID: 6, Title: "Deleted", StatusID: NotStarted, Estimate: 40, EstimateUnit: Hours, Deleted: true, Revision: 1},
+	}}, map[int]int{1: 6})
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	two, three := start.Add(2*time.Hour), start.Add(3*time.Hour)
+	LogTime(1, 1, TimeEntry{Start: start, Stop: &two})
+	LogTime(1, 2, TimeEntry{Start: start, Stop: &three})
+
+	summaries, err := GetEstimateSummary(1)
+	if err != nil {
+		t.Fatalf("GetEstimateSummary failed: %v", err)
+	}
+	expected := []EstimateSummary{
+		{Unit: Hours, Tasks: 2, Estimated: 6, Actual: 5, Remaining: 3},
+		{Unit: Points, Tasks: 2, Estimated: 13, Actual: 8, Remaining: 5},
+	}
+	if !slices.Equal(summaries, expected) {
+		t.Errorf("Expected summaries %+v, got %+v", expected, summaries)
+	}
+}
+
+func TestBurndown(t *testing.T) {
+	SetHistoryStore(NewMemoryHistory())
+	defer SetHistoryStore(NewMemoryHistory())
+
+	// Task 1 is created on the first day and completed on the third, task 2 is added on the second day
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	completed := Task{ID: 1, Title: "First", StatusID: Completed, Estimate: 5, EstimateUnit: Hours, Revision: 2}
+	open := Task{ID: 2, Title: "Second", StatusID: NotStarted, Estimate: 3, EstimateUnit: Hours, Revision: 1}
+	points := Task{ID: 3, Title: "Pointed", StatusID: NotStarted, Estimate: 8, EstimateUnit: Points, Revision: 1}
+	SetTasks(map[int][]Task{1: {completed, open, points}}, map[int]int{1: 3})
+	started := completed
+	started.StatusID = NotStarted
+	GetHistoryStore().Append(
+		HistoryEntry{TaskID: 1, UserID: 1, Change: ChangeCreated, Time: day, Changes: diffTasks(Task{}, started)},
+		HistoryEntry{TaskID: 2, UserID: 1, Change: ChangeCreated, Time: day.AddDate(0, 0, 1), Changes: diffTasks(Task{}, open)},
+		HistoryEntry{TaskID: 1, UserID: 1, Change: ChangeUpdated, Time: day.AddDate(0, 0, 2), Changes: diffTasks(started, completed)},
+	)
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	burndown, err := GetBurndown(1, BurndownOptions{From: from, To: from.AddDate(0, 0, 3), Unit: Hours})
+	if err != nil {
+		t.Fatalf("GetBurndown failed: %v", err)
+	}
+	expected := []struct{ remaining, scope, ideal float64 }{{5, 5, 5}, {8, 8, 5 * 2.0 / 3}, {3, 8, 5 * 1.0 / 3}, {3, 8, 0}}
+	if len(burndown.Points) != len(expected) || burndown.From != "2026-03-01" || burndown.To != "2026-03-04" {
+		t.Fatalf("Unexpected burndown %+v", burndown)
+	}
+	for i, point := range burndown.Points {
+		if point.Remaining == nil || *point.Remaining != expected[i].remaining || *point.Scope != expected[i].scope ||
+			math.Abs(point.Ideal-expected[i].ideal) > 1e-9 {
+			t.Errorf("Unexpected point %d %+v, expected %+v", i, point, expected[i])
+		}
+	}
+
+	// Tasks created before their history was recorded count on every day
+	byPoints, _ := GetBurndown(1, BurndownOptions{From: from, To: from.AddDate(0, 0, 1), Unit: Points})
+	if remaining := byPoints.Points[0].Remaining; remaining == nil || *remaining != 8 {
+		t.Errorf("Expected 8 points left on the first day, got %+v", byPoints.Points[0])
+	}
+
+	// Days still to come only have the ideal line
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	upcoming, _ := GetBurndown(1, BurndownOptions{From: today, To: today.AddDate(0, 0, 2)})
+	if len(upcoming.Points) != 3 || upcoming.Points[0].Remaining == nil || upcoming.Points[2].Remaining != nil || upcoming.Points[2].Ideal != 0 {
+		t.Errorf("Unexpected upcoming burndown %+v", upcoming)
+	}
+
+	for query, field := range map[string]string{"unit=days": "unit", "from=yesterday": "from", "from=2026-01-02&to=2026-01-01": "to", "from=2024-01-01&to=2026-01-01": "to"} {
+		values, _ := url.ParseQuery(query)
+		var fieldErr *FieldError
+		if _, err := ParseBurndownOptions(values, time.Now()); !errors.As(err, &fieldErr) || fieldErr.Field != field {
+			t.Errorf("Expected a %s error for %q, got %v", field, query, err)
+		}
+	}
+	if opts, err := ParseBurndownOptions(url.Values{}, day); err != nil || !opts.From.Equal(time.Date(2026, 2, 16, 0, 0, 0, 0, time.Local)) || opts.Unit != Hours {
+		t.Errorf("Expected the last two weeks in hours by default, got %+v: %v", opts, err)
+	}
+}
+
+func TestComments(t *testing.T) {
+	SetTasks(map[int][]Task{1: {{ID: 1, Title: "Task 1", StatusID: NotStarted, Revision: 1}}}, map[int]int{1: 1})
+
+	first, err := AddComment(1, 1, 1, "First")
+	if err != nil || first.ID != 1 || first.AuthorID != 1 || first.CreatedAt == nil || first.UpdatedAt != nil {
+		t.Fatalf("Unexpected first comment %+v: %v", first, err)
+	}
+	if _, err := AddComment(1, 1, 1, "Second"); err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+	if err := DeleteComment(1, 1, 2); err != nil {
+		t.Fatalf("DeleteComment failed: %v", err)
+	}
+	// IDs of deleted comments are not reused
+	third, _ := AddComment(1, 1, 1, "Third")
+	if third.ID != 3 {
+		t.Errorf("Expected the next comment to get ID 3, got %d", third.ID)
+	}
+
+	edited, err := UpdateComment(1, 1, 1, "  Edited ")
+	if err != nil || edited.Body != "Edited" || edited.UpdatedAt == nil || !edited.CreatedAt.Equal(*first.CreatedAt) {
+		t.Errorf("Unexpected edited comment %+v: %v", edited, err)
+	}
+
+	comments, _ := GetComments(1, 1)
+	if len(comments) != 2 || comments[0].Body != "Edited" || comments[1].Body != "Third" {
+		t.Errorf("Unexpected comments %+v", comments)
+	}
+	if task, _ := GetTask(1, 1); task.Revision != 6 {
+		t.Errorf("Expected every comment change to bump the revision to 6, got %d", task.Revision)
+	}
+
+	if _, err := AddComment(1, 1, 1, strings.Repeat("a", MaxCommentLength+1)); !errors.Is(err, ErrInvalidComment) {
+		t.Errorf("Expected ErrInvalidComment for a long comment, got %v", err)
+	}
+	if _, err := UpdateComment(1, 1, 2, "Gone"); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("Expected ErrCommentNotFound for a deleted comment, got %v", err)
+	}
+	if _, err := GetComments(1, 2); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for an unknown task, got %v", err)
+	}
+
+	// Comments are only changed through the comment functions
+	created, _ := CreateTask(1, Task{Title: "Task 2", StatusString: "NotStarted", Comments: comments, MaxCommentID: 3})
+	if created.Comments != nil || created.MaxCommentID != 0 {
+		t.Errorf("Expected a new task to start without comments, got %+v", created)
+	}
+	updated, _ := UpdateTask(1, Task{ID: 1, Title: "Task 1", StatusString: "Started"})
+	if len(updated.Comments) != 2 {
+		t.Errorf("Expected an update to keep the comments, got %+v", updated.Comments)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	InitChannel(10)
+	SetTasks(nil, nil)
+	SetHistoryStore(NewMemoryHistory())
+	submit := func(req Request) Response {
+		t.Helper()
+		req.UserID = 1
+		req.TraceID = "trace-" + req.Action
+		res, err := Submit(context.Background(), req)
+		if err != nil || res.Error != nil {
+			t.Fatalf("%s request failed: %v %v", req.Action, err, res.Error)
+		}
+		return res
+	}
+
+	submit(Request{Action: CreateRequest, Task: Task{Title: "Parent", StatusString: "NotStarted"}})
+	submit(Request{Action: CreateRequest, Task: Task{Title: "Child", StatusString: "NotStarted", ParentID: 1}})
+	status := "Started"
+	submit(Request{Action: PatchRequest, TaskID: 2, Patch: Patch{Status: &status}})
+	// An update that changes nothing is not recorded
+	submit(Request{Action: UpdateRequest, Task: Task{ID: 2, Title: "Child", StatusString: "Started", ParentID: 1}})
+	submit(Request{Action: DeleteRequest, TaskID: 1})
+	submit(Request{Action: PurgeRequest, TaskID: 1})
+	// Changes made outside the actor loops are not recorded
+	if _, err := CreateTask(1, Task{Title: "Direct", StatusString: "NotStarted"}); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	history := submit(Request{Action: HistoryRequest, TaskID: 2}).History
+	changes := make([]string, len(history))
+	for i, entry := range history {
+		changes[i] = entry.Action + ":" + entry.Change
+		if entry.UserID != 1 || entry.TraceID != "trace-"+entry.Action || entry.Time.IsZero() {
+			t.Errorf("Unexpected entry %+v", entry)
+		}
+	}
+	if !slices.Equal(changes, []string{"create:created", "patch:updated", "delete:updated"}) {
+		t.Fatalf("Unexpected history of the child %v", changes)
+	}
+	patched := history[1]
+	var fields []string
+	for _, change := range patched.Changes {
+		fields = append(fields, change.Field)
+	}
+	if patched.Revision != 2 || !slices.Equal(fields, []string{"status", "status_id"}) ||
+		string(patched.Changes[0].Before) != `"NotStarted"` || string(patched.Changes[0].After) != `"Started"` {
+		t.Errorf("Unexpected patch entry %+v", patched)
+	}
+	if detached := history[2].Changes; len(detached) != 1 || detached[0].Field != "parent_id" || string(detached[0].After) != "0" {
+		t.Errorf("Expected detaching the child to change its parent_id, got %+v", detached)
+	}
+
+	history = submit(Request{Action: HistoryRequest, TaskID: 1}).History
+	if len(history) != 3 || history[1].Change != ChangeDeleted || history[2].Change != ChangePurged || history[2].Revision != 0 {
+		t.Errorf("Expected the purged parent to keep its history, got %+v", history)
+	}
+	if history := submit(Request{Action: HistoryRequest, TaskID: 3}).History; history == nil || len(history) != 0 {
+		t.Errorf("Expected an empty history for the direct task, got %+v", history)
+	}
+	res, _ := Submit(context.Background(), Request{UserID: 1, Action: HistoryRequest, TaskID: 42})
+	if !errors.Is(res.Error, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for an unknown task, got %v", res.Error)
+	}
+}
+
+func TestDiffTasksCollections(t *testing.T) {
+	before := Task{Title: "Task", Checklist: []ChecklistItem{{ID: 1, Text: "one"}, {ID: 2, Text: "two"}, {ID: 3, Text: "three"}}}
+	after := Task{Title: "Task", Checklist: []ChecklistItem{{ID: 3, Text: "three"}, {ID: 1, Text: "one", Done: true}, {ID: 4, Text: "four"}}}
+
+	changes := diffTasks(before, after)
+	got := make([]string, len(changes))
+	for i, change := range changes {
+		got[i] = change.Field + " " + string(change.Before) + " -> " + string(change.After)
+	}
+	expected := []string{
+		`checklist/1 {"id":1,"text":"one","done":false} -> {"id":1,"text":"one","done":true}`,
+		`checklist/2 {"id":2,"text":"two","done":false} -> `,
+		`checklist/4  -> {"id":4,"text":"four","done":false}`,
+		`checklist/order [1,2,3] -> [3,1,4]`,
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected the checklist to be diffed item by item\nexpected %q\ngot      %q", expected, got)
+	}
+
+	// Adding an item keeps the order of the others, so only the item is recorded
+	after = Task{Title: "Task", Checklist: append(slices.Clone(before.Checklist), ChecklistItem{ID: 4, Text: "four"})}
+	if changes := diffTasks(before, after); len(changes) != 1 || changes[0].Field != "checklist/4" {
+		t.Errorf("Expected only the added item to be recorded, got %+v", changes)
+	}
+}
+
+func TestMemoryHistoryListUserSince(t *testing.T) {
+	history := NewMemoryHistory()
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 6 {
+		history.Append(HistoryEntry{TaskID: i%2 + 1, UserID: 1, Revision: i, Time: start.Add(time.Duration(i) * time.Hour)})
+	}
+	history.Append(HistoryEntry{TaskID: 1, UserID: 2, Time: start.Add(5 * time.Hour)})
+
+	entries, _ := history.ListUserSince(1, start.Add(3*time.Hour))
+	if len(entries) != 3 || entries[0].Revision != 3 || entries[2].Revision != 5 {
+		t.Errorf("Expected the last 3 entries of user 1, got %+v", entries)
+	}
+	if entries, _ := history.List(1, 2); len(entries) != 3 || entries[0].Revision != 1 || entries[2].Revision != 5 {
+		t.Errorf("Expected the entries of task 2 oldest first, got %+v", entries)
+	}
+}
+
+// failingHistory is a HistoryStore whose appends fail
+type failingHistory struct {
+	*MemoryHistory
+}
+
+func (failingHistory) Append(entries ...HistoryEntry) error {
+	return errors.New("disk full")
+}
+
+func TestHistoryAppendFailure(t *testing.T) {
+	InitChannel(10)
+	SetTasks(nil, nil)
+	SetHistoryStore(failingHistory{NewMemoryHistory()})
+	defer SetHistoryStore(NewMemoryHistory())
+
+	res, err := Submit(context.Background(), Request{UserID: 1, Action: CreateRequest, Task: Task{Title: "Task", StatusString: "NotStarted"}})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if !errors.Is(res.Error, ErrHistoryNotRecorded) {
+		t.Errorf("Expected ErrHistoryNotRecorded when the history cannot be written, got %v", res.Error)
+	}
+
+	// Requests that change nothing do not write history and still succeed
+	res, _ = Submit(context.Background(), Request{UserID: 1, Action: GetTaskRequest, TaskID: 1})
+	if res.Error != nil {
+		t.Errorf("Expected reading a task to succeed, got %v", res.Error)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(nil, nil)
+
+	created, err := store.Create(1, Task{Title: "Task 1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.ID != 1 {
+		t.Errorf("Expected task ID 1, got %d", created.ID)
+	}
+
+	created.Title = "Updated Task 1"
+	if err := store.Update(1, created); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	got, err := store.Get(1, 1)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Title != "Updated Task 1" {
+		t.Errorf("Expected task title to be 'Updated Task 1', got '%s'", got.Title)
+	}
+
+	if _, err := store.Get(2, 1); err != ErrTaskNotFound {
+		t.Errorf("Expected ErrTaskNotFound for another user, got %v", err)
+	}
+
+	if err := store.Delete(1, 1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	tasks, _ := store.List(1)
+	if len(tasks) != 0 {
+		t.Errorf("Expected 0 tasks after delete, got %d", len(tasks))
+	}
+
+	next, _ := store.Create(1, Task{Title: "Task 2"})
+	if next.ID != 2 {
+		t.Errorf("Expected deleted task IDs not to be reused, got %d", next.ID)
+	}
+}
+
+func TestMemoryStoreDueBy(t *testing.T) {
+	now := time.Now()
+	in := func(d time.Duration) *time.Time {
+		due := now.Add(d)
+		return &due
+	}
+	store := NewMemoryStore(map[int][]Task{
+		1: {
+			{ID: 1, Title: "Due soon", DueDate: in(time.Hour)},
+			{ID: 2, Title: "Due later", DueDate: in(48 * time.Hour)},
+			{ID: 3, Title: "Completed", StatusID: Completed, DueDate: in(time.Minute)},
+		},
+		2: {{ID: 1, Title: "Deleted", Deleted: true, DueDate: in(time.Minute)}},
+		3: {{ID: 1, Title: "No due date"}},
+	}, map[int]int{1: 3, 2: 1, 3: 1})
+	dueBy := func(int) time.Time { return now.Add(2 * time.Hour) }
+
+	due := store.DueBy(dueBy)
+	if len(due) != 1 || len(due[1]) != 1 || due[1][0].ID != 1 {
+		t.Fatalf("Expected only task 1 of user 1 to be due, got %+v", due)
+	}
+
+	// Completing the task moves the next due date of the user out of the window
+	completed := due[1][0]
+	completed.StatusID = Completed
+	if err := store.Update(1, completed); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if due := store.DueBy(dueBy); len(due) != 0 {
+		t.Errorf("Expected no tasks due after completing task 1, got %+v", due)
+	}
+
+	created, _ := store.Create(3, Task{Title: "New", DueDate: in(30 * time.Minute)})
+	if due := store.DueBy(dueBy); len(due[3]) != 1 || due[3][0].ID != created.ID {
+		t.Errorf("Expected the new task of user 3 to be due, got %+v", due)
+	}
+
+	// Moving or removing the earliest task falls back to the next one
+	created.DueDate = in(72 * time.Hour)
+	store.Update(3, created)
+	if due := store.DueBy(dueBy); len(due[3]) != 0 {
+		t.Errorf("Expected the moved task of user 3 to be out of the window, got %+v", due)
+	}
+	later, _ := store.Create(3, Task{Title: "Later", DueDate: in(90 * time.Minute)})
+	if due := store.DueBy(dueBy); len(due[3]) != 1 || due[3][0].ID != later.ID {
+		t.Errorf("Expected the later task of user 3 to be due, got %+v", due)
+	}
+	store.Delete(3, later.ID)
+	if due := store.DueBy(func(int) time.Time { return now.Add(80 * time.Hour) }); len(due[3]) != 1 || due[3][0].ID != created.ID {
+		t.Errorf("Expected the moved task to be the next one due, got %+v", due)
+	}
+}
+
+func TestInitShardsStopsReplacedLoops(t *testing.T) {
+	SetTasks(nil, nil)
+	InitChannel(10)
+
+	// A request queued before the shards are replaced is still answered by the old loop
+	release := make(chan Response)
+	Send(Request{UserID: 1, Action: GetRequest, Response: release})
+	queued := make(chan Response, 1)
+	Send(Request{UserID: 1, Action: CreateRequest, Task: Task{Title: "Queued", StatusString: "NotStarted"}, Response: queued})
+
+	goroutines := runtime.NumGoroutine()
+	for range 10 {
+		InitShards(4, 10)
+	}
+	<-release
+	if res := <-queued; res.Error != nil {
+		t.Errorf("Expected the queued request to be answered, got %v", res.Error)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines+4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected replaced loops to stop, %d goroutines left of %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShardsRouteUsersToTheirOwnLoop(t *testing.T) {
+	SetTasks(nil, nil)
+	InitShards(4, 10)
+
+	for userID := 1; userID <= 8; userID++ {
+		response := make(chan Response, 1)
+		Send(Request{
+			UserID:   userID,
+			Action:   CreateRequest,
+			Task:     Task{Title: "Task", StatusString: "NotStarted"},
+			Response: response,
+		})
+		if res := <-response; res.Error != nil {
+			t.Fatalf("CreateRequest for user %d failed: %v", userID, res.Error)
+		}
+	}
+
+	for userID := 1; userID <= 8; userID++ {
+		if shardFor(userID) != shards[userID%4] {
+			t.Errorf("Expected user %d to be served by shard %d", userID, userID%4)
+		}
+
+		tasks, _ := GetTasks(userID)
+		if len(tasks) != 1 || tasks[0].ID != 1 {
+			t.Errorf("Expected user %d to have a single task with ID 1, got %+v", userID, tasks)
+		}
 	}
 }
 
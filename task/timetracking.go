@@ -0,0 +1,378 @@
+package task
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxTimeEntryNoteLength is the longest note, in bytes, a time entry accepts
+const MaxTimeEntryNoteLength = 1000
+
+// Groupings of a time report
+const (
+	GroupByTask = "task"
+	GroupByTag  = "tag"
+	GroupByDay  = "day"
+)
+
+var (
+	// ErrTimeEntryNotFound is returned when a task has no time entry with the requested ID
+	ErrTimeEntryNotFound = errors.New("time entry not found")
+	// ErrInvalidTimeEntry is returned for a time entry without a valid start and stop
+	ErrInvalidTimeEntry = errors.New("invalid time entry")
+	// ErrTimerRunning is returned when a timer is started while another one of the user runs
+	ErrTimerRunning = errors.New("a timer is already running")
+	// ErrNoTimer is returned when no timer of the user runs
+	ErrNoTimer = errors.New("no timer is running")
+)
+
+// TimeEntry is a span of time spent on a task
+type TimeEntry struct {
+	ID    int       `json:"id"`
+	Start time.Time `json:"start"`
+	// Stop is nil while the timer of the entry runs
+	Stop *time.Time `json:"stop"`
+	// Duration is the length of a stopped entry in seconds
+	Duration int64  `json:"duration_seconds"`
+	Note     string `json:"note"`
+}
+
+// Timer is the running time entry of a user and the task it is for
+type Timer struct {
+	TaskID int `json:"task_id"`
+	TimeEntry
+}
+
+// TimeReportOptions selects the time entries of a report and how they are grouped
+type TimeReportOptions struct {
+	// From and To limit the report to the time between them; entries crossing them are cut
+	From *time.Time
+	To   *time.Time
+	// GroupBy is one of the GroupBy constants
+	GroupBy string
+}
+
+// TimeReportRow is the time spent on one task, tag or day
+type TimeReportRow struct {
+	// Key is the task ID, tag or YYYY-MM-DD day of the row; it is empty for untagged tasks
+	Key string `json:"key"`
+	// Title is the title of the task of a row grouped by task
+	Title   string `json:"title,omitempty"`
+	Seconds int64  `json:"seconds"`
+}
+
+// TimeReport is the time spent on the tasks of a user
+type TimeReport struct {
+	GroupBy string          `json:"group_by"`
+	From    *time.Time      `json:"from"`
+	To      *time.Time      `json:"to"`
+	Rows    []TimeReportRow `json:"rows"`
+	// TotalSeconds counts every second once, also when a task has several tags
+	TotalSeconds int64 `json:"total_seconds"`
+}
+
+// normalizeNote trims the note of a time entry and checks its length
+func normalizeNote(note string) (string, error) {
+	note = strings.TrimSpace(note)
+	if len(note) > MaxTimeEntryNoteLength {
+		return "", &FieldError{Field: "note", Err: fmt.Errorf("%w: note longer than %d bytes", ErrInvalidTimeEntry, MaxTimeEntryNoteLength)}
+	}
+	return note, nil
+}
+
+// GetTimeEntries returns the time entries of a task, oldest first
+func GetTimeEntries(userID int, taskID int) ([]TimeEntry, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.TimeEntries == nil {
+		return []TimeEntry{}, nil
+	}
+	return task.TimeEntries, nil
+}
+
+// LogTime adds a stopped time entry to a task and returns it
+func LogTime(userID int, taskID int, entry TimeEntry) (TimeEntry, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	if entry.Start.IsZero() {
+		return TimeEntry{}, &FieldError{Field: "start", Err: fmt.Errorf("%w: a start time is required", ErrInvalidTimeEntry)}
+	}
+	if entry.Stop == nil || !entry.Stop.After(entry.Start) {
+		return TimeEntry{}, &FieldError{Field: "stop", Err: fmt.Errorf("%w: the stop time must be after the start time", ErrInvalidTimeEntry)}
+	}
+	if entry.Note, err = normalizeNote(entry.Note); err != nil {
+		return TimeEntry{}, err
+	}
+
+	task.MaxTimeEntryID++
+	entry.ID = task.MaxTimeEntryID
+	entry.Duration = int64(entry.Stop.Sub(entry.Start) / time.Second)
+	task.TimeEntries = append(slices.Clone(task.TimeEntries), entry)
+	now := time.Now()
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return TimeEntry{}, err
+	}
+	return entry, nil
+}
+
+// DeleteTimeEntry removes a time entry from a task; removing a running entry stops its timer
+func DeleteTimeEntry(userID int, taskID int, entryID int) error {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return err
+	}
+	index := slices.IndexFunc(task.TimeEntries, func(entry TimeEntry) bool { return entry.ID == entryID })
+	if index < 0 {
+		return ErrTimeEntryNotFound
+	}
+
+	now := time.Now()
+	task.TimeEntries = slices.Delete(slices.Clone(task.TimeEntries), index, index+1)
+	task.UpdatedAt = &now
+	_, err = saveTask(userID, task)
+	return err
+}
+
+// GetTimer returns the running timer of userID, or ErrNoTimer
+func GetTimer(userID int) (Timer, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return Timer{}, err
+	}
+	for _, task := range tasks {
+		for _, entry := range task.TimeEntries {
+			if entry.Stop == nil {
+				return Timer{TaskID: task.ID, TimeEntry: entry}, nil
+			}
+		}
+	}
+	return Timer{}, ErrNoTimer
+}
+
+// StartTimer starts timing a task and returns the running timer
+// A user has at most one running timer. A task that has not been started moves to the
+// first started state of its workflow, if the workflow allows it.
+func StartTimer(userID int, taskID int, note string) (Timer, error) {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return Timer{}, err
+	}
+	if running, err := GetTimer(userID); err == nil {
+		return Timer{}, fmt.Errorf("%w on task %d", ErrTimerRunning, running.TaskID)
+	} else if !errors.Is(err, ErrNoTimer) {
+		return Timer{}, err
+	}
+	if note, err = normalizeNote(note); err != nil {
+		return Timer{}, err
+	}
+	if err := autoStart(userID, &task); err != nil {
+		return Timer{}, err
+	}
+
+	now := time.Now()
+	task.MaxTimeEntryID++
+	entry := TimeEntry{ID: task.MaxTimeEntryID, Start: now, Note: note}
+	task.TimeEntries = append(slices.Clone(task.TimeEntries), entry)
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return Timer{}, err
+	}
+	return Timer{TaskID: task.ID, TimeEntry: entry}, nil
+}
+
+// StopTimer stops the running timer of userID and returns its entry
+func StopTimer(userID int) (Timer, error) {
+	running, err := GetTimer(userID)
+	if err != nil {
+		return Timer{}, err
+	}
+	task, err := GetTask(userID, running.TaskID)
+	if err != nil {
+		return Timer{}, err
+	}
+
+	now := time.Now()
+	stopTimers(&task, now)
+	task.UpdatedAt = &now
+	if _, err := saveTask(userID, task); err != nil {
+		return Timer{}, err
+	}
+	index := slices.IndexFunc(task.TimeEntries, func(entry TimeEntry) bool { return entry.ID == running.ID })
+	return Timer{TaskID: task.ID, TimeEntry: task.TimeEntries[index]}, nil
+}
+
+// stopTimers stops the running time entries of a task at now
+func stopTimers(task *Task, now time.Time) {
+	if !slices.ContainsFunc(task.TimeEntries, func(entry TimeEntry) bool { return entry.Stop == nil }) {
+		return
+	}
+	task.TimeEntries = slices.Clone(task.TimeEntries)
+	for i, entry := range task.TimeEntries {
+		if entry.Stop == nil {
+			task.TimeEntries[i].Stop = &now
+			task.TimeEntries[i].Duration = int64(now.Sub(entry.Start) / time.Second)
+		}
+	}
+}
+
+// autoStart moves a task that has not been started to the first started state of its workflow
+// The task stays as it is when the workflow does not allow the transition; open blockers refuse it
+// like a status change would.
+func autoStart(userID int, task *Task) error {
+	if task.StatusID != NotStarted {
+		return nil
+	}
+	workflow := WorkflowFor(userID)
+	for _, state := range workflow.States {
+		if state.Status() != Started || workflow.CheckTransition(task.stateName(), state.Name) != nil {
+			continue
+		}
+		started := *task
+		started.setState(state)
+		if err := checkBlocked(userID, task.StatusID, started); err != nil {
+			return err
+		}
+		*task = started
+		return nil
+	}
+	return nil
+}
+
+// TimeSpent returns the time spent on a task, counting running entries up to now
+func (t Task) TimeSpent(now time.Time) time.Duration {
+	var spent time.Duration
+	for _, entry := range t.TimeEntries {
+		spent += entry.span(now)
+	}
+	return spent
+}
+
+// span returns the length of the entry, counting a running entry up to now
+func (e TimeEntry) span(now time.Time) time.Duration {
+	if e.Stop == nil {
+		return max(now.Sub(e.Start), 0)
+	}
+	return e.Stop.Sub(e.Start)
+}
+
+// ParseTimeReportOptions reads the from, to and group query parameters of a time report
+func ParseTimeReportOptions(query url.Values) (TimeReportOptions, error) {
+	var opts TimeReportOptions
+	var err error
+	if opts.From, err = parseTimeParam(query, "from"); err != nil {
+		return TimeReportOptions{}, err
+	}
+	if opts.To, err = parseTimeParam(query, "to"); err != nil {
+		return TimeReportOptions{}, err
+	}
+	if opts.From != nil && opts.To != nil && !opts.To.After(*opts.From) {
+		return TimeReportOptions{}, &FieldError{Field: "to", Err: errors.New("must be after from")}
+	}
+
+	switch group := query.Get("group"); group {
+	case "":
+		opts.GroupBy = GroupByTask
+	case GroupByTask, GroupByTag, GroupByDay:
+		opts.GroupBy = group
+	default:
+		return TimeReportOptions{}, &FieldError{Field: "group", Err: fmt.Errorf("unknown grouping %q, expected task, tag or day", group)}
+	}
+	return opts, nil
+}
+
+// GetTimeReport adds up the time spent on the non-deleted tasks of userID
+// Running timers count up to now. Rows grouped by day are in date order, using the local time zone
+// and splitting entries at midnight; other rows have the most time first.
+func GetTimeReport(userID int, opts TimeReportOptions) (TimeReport, error) {
+	if opts.GroupBy == "" {
+		opts.GroupBy = GroupByTask
+	}
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return TimeReport{}, err
+	}
+
+	now := time.Now()
+	spent := make(map[string]time.Duration)
+	titles := make(map[string]string)
+	var total time.Duration
+	for _, task := range tasks {
+		for _, entry := range task.TimeEntries {
+			start, stop, ok := opts.clip(entry, now)
+			if !ok {
+				continue
+			}
+			total += stop.Sub(start)
+			switch opts.GroupBy {
+			case GroupByTask:
+				key := strconv.Itoa(task.ID)
+				spent[key] += stop.Sub(start)
+				titles[key] = task.Title
+			case GroupByTag:
+				if len(task.Tags) == 0 {
+					spent[""] += stop.Sub(start)
+				}
+				for _, tag := range task.Tags {
+					spent[tag] += stop.Sub(start)
+				}
+			case GroupByDay:
+				for day := start; day.Before(stop); {
+					midnight := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+					end := minTime(midnight, stop)
+					spent[day.Format(time.DateOnly)] += end.Sub(day)
+					day = end
+				}
+			}
+		}
+	}
+
+	report := TimeReport{
+		GroupBy:      opts.GroupBy,
+		From:         opts.From,
+		To:           opts.To,
+		Rows:         make([]TimeReportRow, 0, len(spent)),
+		TotalSeconds: int64(total / time.Second),
+	}
+	for key, duration := range spent {
+		report.Rows = append(report.Rows, TimeReportRow{Key: key, Title: titles[key], Seconds: int64(duration / time.Second)})
+	}
+	slices.SortFunc(report.Rows, func(a, b TimeReportRow) int {
+		if opts.GroupBy == GroupByDay {
+			return cmp.Compare(a.Key, b.Key)
+		}
+		return cmp.Or(cmp.Compare(b.Seconds, a.Seconds), cmp.Compare(a.Key, b.Key))
+	})
+	return report, nil
+}
+
+// clip returns the part of the entry inside the report range in local time, or false when there is none
+func (o TimeReportOptions) clip(entry TimeEntry, now time.Time) (time.Time, time.Time, bool) {
+	start := entry.Start.Local()
+	stop := start.Add(entry.span(now))
+	if o.From != nil && start.Before(*o.From) {
+		start = o.From.Local()
+	}
+	if o.To != nil && stop.After(*o.To) {
+		stop = o.To.Local()
+	}
+	return start, stop, stop.After(start)
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
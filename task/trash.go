@@ -0,0 +1,164 @@
+package task
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ErrNotDeleted is returned when a task that is not in the trash is restored or purged
+var ErrNotDeleted = errors.New("task is not deleted")
+
+// GetDeletedTasks returns the soft-deleted tasks of userID, most recently deleted first
+func GetDeletedTasks(userID int) ([]Task, error) {
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []Task{}
+	for _, task := range tasks {
+		if task.Deleted {
+			deleted = append(deleted, task)
+		}
+	}
+	slices.SortFunc(deleted, func(a, b Task) int {
+		return cmp.Or(compareTimes(b.DeletedAt, a.DeletedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return deleted, nil
+}
+
+// RestoreTask takes a soft-deleted task out of the trash
+// A subtask whose parent is still deleted or was purged moves to the top level.
+// Subtasks deleted along with the task stay in the trash until they are restored themselves.
+func RestoreTask(userID int, taskID int) (Task, error) {
+	task, err := GetStore().Get(userID, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if !task.Deleted {
+		return Task{}, ErrNotDeleted
+	}
+
+	if task.ParentID != 0 {
+		if _, err := GetTask(userID, task.ParentID); errors.Is(err, ErrTaskNotFound) {
+			task.ParentID = 0
+		} else if err != nil {
+			return Task{}, err
+		}
+	}
+
+	now := time.Now()
+	task.Deleted = false
+	task.DeletedAt = nil
+	task.UpdatedAt = &now
+	return saveTask(userID, task)
+}
+
+// PurgeTask permanently removes a soft-deleted task
+func PurgeTask(userID int, taskID int) error {
+	task, err := GetStore().Get(userID, taskID)
+	if err != nil {
+		return err
+	}
+	if !task.Deleted {
+		return ErrNotDeleted
+	}
+	return purgeTasks(userID, []int{taskID})
+}
+
+// PurgeDeletedBefore permanently removes the tasks of userID deleted before cutoff and returns them
+func PurgeDeletedBefore(userID int, cutoff time.Time) ([]Task, error) {
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Task
+	var ids []int
+	for _, task := range tasks {
+		if isExpired(task, cutoff) {
+			expired = append(expired, task)
+			ids = append(ids, task.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return expired, purgeTasks(userID, ids)
+}
+
+// isExpired reports whether task was deleted before cutoff
+func isExpired(task Task, cutoff time.Time) bool {
+	return task.Deleted && task.DeletedAt != nil && task.DeletedAt.Before(cutoff)
+}
+
+// purgeTasks removes the tasks with ids from the store and drops the references other tasks hold to them
+// Subtasks of a purged task move to the top level, purged blockers are removed and
+// the content of attachments no other task has is deleted.
+func purgeTasks(userID int, ids []int) error {
+	var digests []string
+	for _, id := range ids {
+		task, err := GetStore().Get(userID, id)
+		if err != nil {
+			return err
+		}
+		for _, attachment := range task.Attachments {
+			digests = append(digests, attachment.SHA256)
+		}
+		if err := removeTask(userID, id); err != nil {
+			return err
+		}
+	}
+	defer releaseBlobs(userID, digests)
+
+	tasks, err := GetStore().List(userID)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		changed := false
+		if slices.Contains(ids, task.ParentID) {
+			task.ParentID = 0
+			changed = true
+		}
+		if slices.ContainsFunc(task.BlockedBy, func(id int) bool { return slices.Contains(ids, id) }) {
+			task.BlockedBy = slices.DeleteFunc(slices.Clone(task.BlockedBy), func(id int) bool { return slices.Contains(ids, id) })
+			changed = true
+		}
+		if changed {
+			if _, err := saveTask(userID, task); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeExpired permanently removes the tasks of every user deleted before cutoff and returns how many it removed
+// The purges go through the actor loops, so it is safe to call while they serve requests.
+func PurgeExpired(ctx context.Context, cutoff time.Time) (int, error) {
+	tasks, _ := GetStore().Snapshot()
+
+	purged := 0
+	var errs []error
+	for _, userID := range slices.Sorted(maps.Keys(tasks)) {
+		if !slices.ContainsFunc(tasks[userID], func(task Task) bool { return isExpired(task, cutoff) }) {
+			continue
+		}
+		res, err := Submit(ctx, Request{UserID: userID, Action: PurgeExpiredRequest, Before: cutoff})
+		if err == nil {
+			err = res.Error
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", userID, err))
+			continue
+		}
+		purged += len(res.Tasks)
+	}
+	return purged, errors.Join(errs...)
+}
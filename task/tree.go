@@ -0,0 +1,255 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ChildPolicy decides what happens to the subtasks of a deleted task
+type ChildPolicy string
+
+const (
+	// DetachChildren moves the subtasks up to the parent of the deleted task
+	DetachChildren ChildPolicy = "detach"
+	// CascadeChildren deletes every descendant along with the task
+	CascadeChildren ChildPolicy = "cascade"
+	// RestrictChildren refuses to delete a task that has subtasks
+	RestrictChildren ChildPolicy = "restrict"
+)
+
+var (
+	// ErrInvalidParent is returned when a parent task does not exist
+	ErrInvalidParent = errors.New("parent task not found")
+	// ErrParentCycle is returned when a parent would make a task its own ancestor
+	ErrParentCycle = errors.New("parent would create a cycle")
+	// ErrHasChildren is returned when a task with subtasks is deleted with RestrictChildren
+	ErrHasChildren = errors.New("task has subtasks")
+	// ErrInvalidChildPolicy is returned for a ChildPolicy that is not one of the constants
+	ErrInvalidChildPolicy = errors.New("invalid child policy")
+)
+
+// ParseChildPolicy converts a policy name to its ChildPolicy; an empty name is DetachChildren
+func ParseChildPolicy(policy string) (ChildPolicy, error) {
+	switch ChildPolicy(policy) {
+	case "":
+		return DetachChildren, nil
+	case DetachChildren, CascadeChildren, RestrictChildren:
+		return ChildPolicy(policy), nil
+	}
+	return "", fmt.Errorf("%w %q, expected detach, cascade or restrict", ErrInvalidChildPolicy, policy)
+}
+
+// Progress is the completion of the descendants of a task
+type Progress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+	// Percent is Completed as a rounded down percentage of Total
+	Percent int `json:"percent"`
+}
+
+// TreeNode is a task with its subtasks
+type TreeNode struct {
+	Task
+	// Progress is set on tasks that have subtasks
+	Progress *Progress  `json:"progress,omitempty"`
+	Children []TreeNode `json:"children"`
+}
+
+// validateParent checks that the parent of task exists and is not the task or one of its descendants
+func validateParent(userID int, task Task) error {
+	if task.ParentID == 0 {
+		return nil
+	}
+	if task.ParentID == task.ID {
+		return &FieldError{Field: "parent_id", Err: ErrParentCycle}
+	}
+
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return err
+	}
+	parents := make(map[int]int, len(tasks))
+	for _, t := range tasks {
+		parents[t.ID] = t.ParentID
+	}
+	if _, ok := parents[task.ParentID]; !ok {
+		return &FieldError{Field: "parent_id", Err: ErrInvalidParent}
+	}
+
+	// Walk up from the new parent; reaching the task means it would become its own ancestor
+	seen := make(map[int]bool)
+	for id := task.ParentID; id != 0 && !seen[id]; id = parents[id] {
+		if id == task.ID {
+			return &FieldError{Field: "parent_id", Err: ErrParentCycle}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// childrenOf returns the non-deleted tasks of userID grouped by their parent ID
+func childrenOf(userID int) (map[int][]Task, error) {
+	tasks, err := GetTasks(userID)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]Task)
+	for _, t := range tasks {
+		if t.ParentID != 0 {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		}
+	}
+	return children, nil
+}
+
+// DeleteTaskWithChildren marks a task as deleted and handles its subtasks according to policy
+// An empty policy is DetachChildren.
+func DeleteTaskWithChildren(userID int, taskID int, policy ChildPolicy) error {
+	task, err := GetTask(userID, taskID)
+	if err != nil {
+		return err
+	}
+	children, err := childrenOf(userID)
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case DetachChildren, "":
+		now := time.Now()
+		for _, child := range children[taskID] {
+			child.ParentID = task.ParentID
+			child.UpdatedAt = &now
+			if _, err := saveTask(userID, child); err != nil {
+				return err
+			}
+		}
+	case CascadeChildren:
+		// Delete the descendants depth first, so a failure never leaves a subtask without its parent
+		var deleteDescendants func(id int, seen map[int]bool) error
+		deleteDescendants = func(id int, seen map[int]bool) error {
+			for _, child := range children[id] {
+				if seen[child.ID] {
+					continue
+				}
+				seen[child.ID] = true
+				if err := deleteDescendants(child.ID, seen); err != nil {
+					return err
+				}
+				if err := DeleteTask(userID, child.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := deleteDescendants(taskID, map[int]bool{taskID: true}); err != nil {
+			return err
+		}
+	case RestrictChildren:
+		if len(children[taskID]) > 0 {
+			return fmt.Errorf("%w: delete or move its %d subtasks first", ErrHasChildren, len(children[taskID]))
+		}
+	default:
+		return ErrInvalidChildPolicy
+	}
+
+	return DeleteTask(userID, taskID)
+}
+
+// BuildTree arranges tasks into trees of subtasks, keeping the order of tasks among siblings
+// A task whose parent is not in tasks is a root. Progress is counted over the
+// descendants in all, so filtering tasks does not change the progress shown.
+func BuildTree(tasks []Task, all []Task) []TreeNode {
+	included := make(map[int]bool, len(tasks))
+	for _, t := range tasks {
+		included[t.ID] = true
+	}
+	children := make(map[int][]Task)
+	var roots []Task
+	for _, t := range tasks {
+		if t.ParentID != 0 && included[t.ParentID] && t.ParentID != t.ID {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	allChildren := make(map[int][]Task)
+	for _, t := range all {
+		if t.ParentID != 0 {
+			allChildren[t.ParentID] = append(allChildren[t.ParentID], t)
+		}
+	}
+
+	visited := make(map[int]bool, len(tasks))
+	var build func(t Task) TreeNode
+	build = func(t Task) TreeNode {
+		visited[t.ID] = true
+		node := TreeNode{Task: withChecklistProgress(t), Children: []TreeNode{}}
+		for _, child := range children[t.ID] {
+			if !visited[child.ID] {
+				node.Children = append(node.Children, build(child))
+			}
+		}
+		if len(allChildren[t.ID]) > 0 {
+			node.Progress = progressOf(t.ID, allChildren)
+		}
+		return node
+	}
+
+	nodes := make([]TreeNode, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, build(root))
+	}
+	// Tasks caught in a parent cycle of older data are never reached from a root; show them as roots
+	for _, t := range tasks {
+		if !visited[t.ID] {
+			nodes = append(nodes, build(t))
+		}
+	}
+	return nodes
+}
+
+// progressOf counts the completed descendants of the task with taskID
+func progressOf(taskID int, children map[int][]Task) *Progress {
+	progress := &Progress{}
+	seen := map[int]bool{taskID: true}
+	pending := slices.Clone(children[taskID])
+	for len(pending) > 0 {
+		t := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[t.ID] {
+			continue
+		}
+		seen[t.ID] = true
+
+		progress.Total++
+		if t.StatusID == Completed {
+			progress.Completed++
+		}
+		pending = append(pending, children[t.ID]...)
+	}
+	if progress.Total > 0 {
+		progress.Percent = progress.Completed * 100 / progress.Total
+	}
+	return progress
+}
+
+// GetTaskTree returns the non-deleted tasks of userID that match opts as trees of subtasks
+// Trees are not paged, so opts must not set Limit or Cursor.
+func GetTaskTree(userID int, opts ListOptions) ([]TreeNode, error) {
+	if opts.Limit != 0 || opts.Cursor != "" {
+		return nil, &FieldError{Field: "view", Err: errors.New("the tree view cannot be paged")}
+	}
+	tasks, _, err := ListTasks(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	all, err := GetTasks(userID)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTree(tasks, all), nil
+}
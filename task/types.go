@@ -6,16 +6,37 @@ import (
 
 // Task represents a to-do task
 type Task struct {
-	ID           int        `json:"id"`
-	Title        string     `json:"title"`
-	Description  string     `json:"description"`
-	StatusID     Status     `json:"status_id"`
-	StatusString string     `json:"status"`
-	CreatedAt    *time.Time `json:"created_at"`
-	UpdatedAt    *time.Time `json:"updated_at"`
-	DueDate      *time.Time `json:"due_date"`
-	DeletedAt    *time.Time `json:"deleted_at"`
-	Deleted      bool       `json:"deleted"`
+	ID             int             `json:"id"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description"`
+	StatusID       Status          `json:"status_id"`
+	StatusString   string          `json:"status"`
+	PriorityID     Priority        `json:"priority_id"`
+	PriorityString string          `json:"priority"`
+	Tags           []string        `json:"tags"`
+	ParentID       int             `json:"parent_id"`
+	BlockedBy      []int           `json:"blocked_by"`
+	CreatedAt      *time.Time      `json:"created_at"`
+	UpdatedAt      *time.Time      `json:"updated_at"`
+	DueDate        *time.Time      `json:"due_date"`
+	Recurrence     string          `json:"recurrence"`
+	NextOccurrence int             `json:"next_occurrence"`
+	Comments       []Comment       `json:"comments"`
+	MaxCommentID   int             `json:"max_comment_id"`
+	Checklist      []ChecklistItem `json:"checklist"`
+	// ChecklistProgress is computed from Checklist when a task is returned and never stored
+	ChecklistProgress     *Progress    `json:"checklist_progress,omitempty"`
+	MaxChecklistItemID    int          `json:"max_checklist_item_id"`
+	ChecklistAutoComplete bool         `json:"checklist_auto_complete"`
+	Attachments           []Attachment `json:"attachments"`
+	MaxAttachmentID       int          `json:"max_attachment_id"`
+	TimeEntries           []TimeEntry  `json:"time_entries"`
+	MaxTimeEntryID        int          `json:"max_time_entry_id"`
+	Estimate              float64      `json:"estimate"`
+	EstimateUnit          string       `json:"estimate_unit"`
+	DeletedAt             *time.Time   `json:"deleted_at"`
+	Deleted               bool         `json:"deleted"`
+	Revision              int          `json:"revision"`
 }
 
 // Manager struct to manage tasks and their state
@@ -27,14 +48,75 @@ type Manager struct {
 // Response represents the response structure for task operations
 type Response struct {
 	Tasks []Task
-	Error error
+	// Next is the cursor of the following page of a paged listing
+	Next string
+	// TagCounts is the result of a tags request
+	TagCounts []TagCount
+	// Tree is the result of a get request with ListOptions.Tree
+	Tree []TreeNode
+	// Graph is the result of a graph request
+	Graph Graph
+	// History is the result of a history request
+	History []HistoryEntry
+	// Comments is the result of a comment request
+	Comments []Comment
+	// Attachments is the result of an attachment request
+	Attachments []Attachment
+	// TimeEntries is the result of a time request
+	TimeEntries []TimeEntry
+	// Timer is the result of a timer request
+	Timer Timer
+	// TimeReport is the result of a time_report request
+	TimeReport TimeReport
+	// Estimates is the result of an estimates request
+	Estimates []EstimateSummary
+	// Burndown is the result of a burndown request
+	Burndown Burndown
+	Error    error
 }
 
 // Request represents a request structure for task operations
 type Request struct {
-	Action   string
-	UserID   int
-	Task     Task
-	TaskID   int
+	Action string
+	UserID int
+	Task   Task
+	TaskID int
+	Patch  Patch
+	// List filters, orders and pages the tasks of a get request
+	List ListOptions
+	// Tags are the tags added or removed by a tag request
+	Tags []string
+	// ChildPolicy decides what a delete request does with the subtasks
+	ChildPolicy ChildPolicy
+	// IfMatch holds the revisions an update or delete is conditional on; empty means unconditional
+	IfMatch []int
+	// Merge makes an update keep the fields it leaves empty, as the legacy /update route always did
+	Merge bool
+	// CommentID is the comment an update_comment or delete_comment request changes
+	CommentID int
+	// Comment is the body of the comment an add_comment or update_comment request writes
+	Comment string
+	// ItemID is the checklist item a toggle, move or remove request changes
+	ItemID int
+	// ItemText is the text of the item an add_checklist_item request adds
+	ItemText string
+	// Position is where a move_checklist_item request moves the item, counted from 0
+	Position int
+	// Attachment is the attachment an add_attachment request records
+	Attachment Attachment
+	// AttachmentID is the attachment a remove_attachment request removes
+	AttachmentID int
+	// TimeEntry is the entry a log_time request adds; its note is the note of a start_timer request
+	TimeEntry TimeEntry
+	// EntryID is the time entry a delete_time_entry request removes
+	EntryID int
+	// TimeReport selects the entries of a time_report request
+	TimeReport TimeReportOptions
+	// Burndown selects the days and the unit of a burndown request
+	Burndown BurndownOptions
+	// TraceID identifies the HTTP request in the history entries of the changes it makes
+	TraceID string
+	// Before is the deletion time before which a purge_expired request removes tasks
+	Before   time.Time
 	Response chan<- Response
 }
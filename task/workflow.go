@@ -0,0 +1,236 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrInvalidTransition is wrapped by TransitionError
+	ErrInvalidTransition = errors.New("status transition not allowed")
+	// ErrInvalidWorkflow is returned for a workflow configuration that cannot be used
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+)
+
+// WorkflowState is a status tasks of a workflow can be in
+type WorkflowState struct {
+	Name string `json:"name"`
+	// Category is the built-in status the state counts as: NotStarted, Started or Completed
+	// It decides whether a task is open, for example for blockers, overdue tasks and progress.
+	Category string `json:"category"`
+}
+
+// Status returns the built-in status of the category of the state
+func (s WorkflowState) Status() Status {
+	status, _ := convertStringToStatusID(s.Category)
+	return status
+}
+
+// Workflow defines the statuses of tasks and the transitions allowed between them
+// The first state is where the next occurrence of a recurring task starts.
+type Workflow struct {
+	States []WorkflowState `json:"states"`
+	// Transitions maps a state to the states a task in it may move to; nil allows every transition
+	// A state missing from a non-nil map is final.
+	Transitions map[string][]string `json:"transitions,omitempty"`
+}
+
+// DefaultWorkflow has the built-in statuses and allows every transition between them
+var DefaultWorkflow = &Workflow{
+	States: []WorkflowState{
+		{Name: NotStarted.String(), Category: NotStarted.String()},
+		{Name: Started.String(), Category: Started.String()},
+		{Name: Completed.String(), Category: Completed.String()},
+	},
+}
+
+// WorkflowConfig assigns workflows to users
+// There is no assignment per project, since tasks do not belong to projects.
+type WorkflowConfig struct {
+	Workflows map[string]*Workflow `json:"workflows"`
+	// Default names the workflow of users without one of their own; empty means DefaultWorkflow
+	Default string `json:"default"`
+	// Users maps user IDs to the name of their workflow
+	Users map[int]string `json:"users"`
+}
+
+// TransitionError reports a status change the workflow of a task does not allow
+type TransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	allowed := "none"
+	if len(e.Allowed) > 0 {
+		allowed = strings.Join(e.Allowed, ", ")
+	}
+	return fmt.Sprintf("%v: cannot move from %s to %s, allowed next statuses: %s", ErrInvalidTransition, e.From, e.To, allowed)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+var workflowConfig atomic.Pointer[WorkflowConfig]
+
+// ParseWorkflowConfig decodes and validates a JSON workflow configuration
+func ParseWorkflowConfig(data []byte) (WorkflowConfig, error) {
+	var config WorkflowConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return WorkflowConfig{}, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+	if err := config.validate(); err != nil {
+		return WorkflowConfig{}, err
+	}
+	return config, nil
+}
+
+// SetWorkflowConfig validates config and makes it the configuration every task operation uses
+func SetWorkflowConfig(config WorkflowConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	workflowConfig.Store(&config)
+	return nil
+}
+
+// validate checks that every workflow is valid and every referenced workflow exists
+func (c WorkflowConfig) validate() error {
+	for name, workflow := range c.Workflows {
+		if workflow == nil {
+			return fmt.Errorf("%w %q: it has no states", ErrInvalidWorkflow, name)
+		}
+		if err := workflow.validate(); err != nil {
+			return fmt.Errorf("workflow %q: %w", name, err)
+		}
+	}
+	if _, ok := c.Workflows[c.Default]; c.Default != "" && !ok {
+		return fmt.Errorf("%w: default workflow %q is not defined", ErrInvalidWorkflow, c.Default)
+	}
+	for userID, name := range c.Users {
+		if _, ok := c.Workflows[name]; !ok {
+			return fmt.Errorf("%w: workflow %q of user %d is not defined", ErrInvalidWorkflow, name, userID)
+		}
+	}
+	return nil
+}
+
+// validate checks the state names and categories and that transitions only name states of the workflow
+func (w *Workflow) validate() error {
+	if len(w.States) == 0 {
+		return fmt.Errorf("%w: it has no states", ErrInvalidWorkflow)
+	}
+	names := make(map[string]bool, len(w.States))
+	for _, state := range w.States {
+		if state.Name == "" || strings.ContainsAny(state.Name, " ,") {
+			return fmt.Errorf("%w: state name %q must be non-empty without spaces or commas", ErrInvalidWorkflow, state.Name)
+		}
+		if names[state.Name] {
+			return fmt.Errorf("%w: state %s is defined twice", ErrInvalidWorkflow, state.Name)
+		}
+		names[state.Name] = true
+		if state.Status() == Unknown {
+			return fmt.Errorf("%w: state %s has category %q, expected NotStarted, Started or Completed", ErrInvalidWorkflow, state.Name, state.Category)
+		}
+	}
+	for from, targets := range w.Transitions {
+		if !names[from] {
+			return fmt.Errorf("%w: transitions from unknown state %s", ErrInvalidWorkflow, from)
+		}
+		for _, to := range targets {
+			if !names[to] {
+				return fmt.Errorf("%w: transition from %s to unknown state %s", ErrInvalidWorkflow, from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// WorkflowFor returns the workflow of userID
+func WorkflowFor(userID int) *Workflow {
+	config := workflowConfig.Load()
+	if config == nil {
+		return DefaultWorkflow
+	}
+	if name, ok := config.Users[userID]; ok {
+		return config.Workflows[name]
+	}
+	if config.Default != "" {
+		return config.Workflows[config.Default]
+	}
+	return DefaultWorkflow
+}
+
+// State returns the state of the workflow called name, ignoring spaces so "Not Started" is NotStarted
+func (w *Workflow) State(name string) (WorkflowState, error) {
+	name = strings.ReplaceAll(name, " ", "")
+	for _, state := range w.States {
+		if state.Name == name {
+			return state, nil
+		}
+	}
+	return WorkflowState{}, fmt.Errorf("%w %q, expected one of %s", ErrInvalidStatus, name, strings.Join(w.stateNames(), ", "))
+}
+
+// stateNames returns the names of the states of the workflow in order
+func (w *Workflow) stateNames() []string {
+	names := make([]string, len(w.States))
+	for i, state := range w.States {
+		names[i] = state.Name
+	}
+	return names
+}
+
+// position returns the index of the state called name in the workflow
+// States the workflow does not know, for example after it changed, come after all of its own.
+func (w *Workflow) position(name string) int {
+	if i := slices.Index(w.stateNames(), name); i >= 0 {
+		return i
+	}
+	return len(w.States)
+}
+
+// NextStates returns the states a task in the state from may move to
+// A task in a state the workflow does not know, for example after its workflow changed, may move to any state.
+func (w *Workflow) NextStates(from string) []string {
+	if w.Transitions == nil || !slices.Contains(w.stateNames(), from) {
+		return slices.DeleteFunc(w.stateNames(), func(name string) bool { return name == from })
+	}
+	return slices.Clone(w.Transitions[from])
+}
+
+// CheckTransition returns a TransitionError if the workflow does not allow moving from one state to another
+// Staying in the same state is always allowed.
+func (w *Workflow) CheckTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+	next := w.NextStates(from)
+	if !slices.Contains(next, to) {
+		return &TransitionError{From: from, To: to, Allowed: next}
+	}
+	return nil
+}
+
+// stateName returns the name of the state of the task, falling back to its built-in status for data without one
+func (t Task) stateName() string {
+	if t.StatusString == "" {
+		return t.StatusID.String()
+	}
+	return t.StatusString
+}
+
+// setState sets the status of the task to state
+func (t *Task) setState(state WorkflowState) {
+	t.StatusID = state.Status()
+	t.StatusString = state.Name
+}
@@ -0,0 +1,83 @@
+package webserver
+
+import (
+	"strconv"
+	"strings"
+	"todoapp/task"
+)
+
+// Size of the burndown chart in SVG user units
+const (
+	chartWidth   = 640
+	chartHeight  = 320
+	chartPadding = 40
+)
+
+type BurndownPageData struct {
+	UserID   int
+	Burndown task.Burndown
+	Chart    BurndownChart
+}
+
+// BurndownChart holds the lines of a burndown as the points attributes of SVG polylines
+type BurndownChart struct {
+	Width  int
+	Height int
+	// Left, Right, Top and Bottom are the edges of the plot area inside the padding
+	Left   int
+	Right  int
+	Top    int
+	Bottom int
+	// Max is the value at the top of the plot area
+	Max       float64
+	Remaining string
+	Scope     string
+	Ideal     string
+}
+
+// NewBurndownChart lays out the points of a burndown on the chart, leaving out the days still to come
+func NewBurndownChart(burndown task.Burndown) BurndownChart {
+	chart := BurndownChart{
+		Width:  chartWidth,
+		Height: chartHeight,
+		Left:   chartPadding,
+		Right:  chartWidth - chartPadding,
+		Top:    chartPadding,
+		Bottom: chartHeight - chartPadding,
+	}
+	for _, point := range burndown.Points {
+		chart.Max = max(chart.Max, point.Ideal)
+		if point.Scope != nil {
+			chart.Max = max(chart.Max, *point.Scope, *point.Remaining)
+		}
+	}
+	scale := chart.Max
+	if scale == 0 {
+		scale = 1
+	}
+
+	var remaining, scope, ideal []string
+	for i, point := range burndown.Points {
+		x := float64(chart.Left+chart.Right) / 2
+		if len(burndown.Points) > 1 {
+			x = float64(chart.Left) + float64(i)*float64(chart.Right-chart.Left)/float64(len(burndown.Points)-1)
+		}
+		y := func(value float64) string {
+			return formatPoint(x, float64(chart.Bottom)-value/scale*float64(chart.Bottom-chart.Top))
+		}
+		ideal = append(ideal, y(point.Ideal))
+		if point.Remaining != nil {
+			remaining = append(remaining, y(*point.Remaining))
+			scope = append(scope, y(*point.Scope))
+		}
+	}
+	chart.Remaining = strings.Join(remaining, " ")
+	chart.Scope = strings.Join(scope, " ")
+	chart.Ideal = strings.Join(ideal, " ")
+	return chart
+}
+
+// formatPoint formats a point of a polyline with one decimal
+func formatPoint(x, y float64) string {
+	return strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+}
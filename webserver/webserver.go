@@ -1,17 +1,20 @@
 package webserver
 
 import (
+	"errors"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"todoapp/task"
 )
 
 type PageData struct {
 	UserID int
-	Tasks  []task.Task
+	// Tasks are the top-level tasks, with their subtasks nested below them
+	Tasks []task.TreeNode
 }
 
 // ServeStaticPage serves a static "about" page
@@ -21,7 +24,7 @@ func ServeStaticPage(mux *http.ServeMux) {
 	})
 }
 
-// ServeDynamicPage serves a dynamic "list" page with all tasks for a specific user
+// ServeDynamicPage serves the dynamic "list" and "burndown" pages of a specific user
 func ServeDynamicPage(mux *http.ServeMux) {
 	mux.HandleFunc("/user/", func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Received request for user tasks", "method", r.Method, "path", r.URL.Path)
@@ -32,8 +35,8 @@ func ServeDynamicPage(mux *http.ServeMux) {
 		}
 
 		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(pathParts) != 3 || pathParts[0] != "user" || pathParts[2] != "list" {
-			http.Error(w, "Invalid URL pattern. Expected /user/{id}/list", http.StatusBadRequest)
+		if len(pathParts) != 3 || pathParts[0] != "user" || (pathParts[2] != "list" && pathParts[2] != "burndown") {
+			http.Error(w, "Invalid URL pattern. Expected /user/{id}/list or /user/{id}/burndown", http.StatusBadRequest)
 			return
 		}
 
@@ -44,23 +47,94 @@ func ServeDynamicPage(mux *http.ServeMux) {
 		}
 
 		w.Header().Set("Content-Type", "text/html")
-
-		tmpl, err := template.ParseFiles("../webserver/templates/list.html")
-		if err != nil {
-			slog.Error("Failed to parse template", "error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if pathParts[2] == "burndown" {
+			serveBurndown(w, r, userID)
 			return
 		}
+		serveList(w, r, userID)
+	})
+}
 
-		pageData := PageData{
-			UserID: userID,
-			Tasks:  task.GetTasks(userID),
-		}
+// serveList renders the tasks of a user as a tree
+func serveList(w http.ResponseWriter, r *http.Request, userID int) {
+	now := time.Now()
+	tmpl, err := template.New("list.html").Funcs(template.FuncMap{
+		"overdue": func(t task.Task) bool { return t.IsOverdue(now) },
+	}).ParseFiles("../webserver/templates/list.html")
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-		err = tmpl.Execute(w, pageData)
-		if err != nil {
-			slog.Error("Failed to execute template", "error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
-	})
+	listOptions, err := task.ParseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := task.GetTaskTree(userID, listOptions)
+	var fieldErr *task.FieldError
+	if errors.As(err, &fieldErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get tasks", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pageData := PageData{
+		UserID: userID,
+		Tasks:  tasks,
+	}
+
+	err = tmpl.Execute(w, pageData)
+	if err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveBurndown renders the burndown of a user as an inline SVG chart
+// It takes the same from, to and unit query parameters as /reports/burndown and, like it, asks the
+// actor loop of the user, so the burndown never sees a request half applied.
+func serveBurndown(w http.ResponseWriter, r *http.Request, userID int) {
+	tmpl, err := template.New("burndown.html").Funcs(template.FuncMap{
+		"effort": func(value *float64) string { return strconv.FormatFloat(*value, 'f', 1, 64) },
+	}).ParseFiles("../webserver/templates/burndown.html")
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	opts, err := task.ParseBurndownOptions(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := task.Submit(r.Context(), task.Request{UserID: userID, Action: task.BurndownRequest, Burndown: opts})
+	if err != nil {
+		http.Error(w, "Service unavailable. Please try again later.", http.StatusServiceUnavailable)
+		return
+	}
+	if res.Error != nil {
+		slog.Error("Failed to get burndown", "error", res.Error)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pageData := BurndownPageData{
+		UserID:   userID,
+		Burndown: res.Burndown,
+		Chart:    NewBurndownChart(res.Burndown),
+	}
+
+	err = tmpl.Execute(w, pageData)
+	if err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
 }